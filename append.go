@@ -0,0 +1,177 @@
+package msgpack
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+)
+
+// MarshalAppend is like Marshal, but appends the encoding of v to dst
+// and returns the extended buffer.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	enc := GetEncoder()
+
+	buf := bytes.NewBuffer(dst)
+	enc.Reset(buf)
+
+	err := enc.Encode(v)
+	b := buf.Bytes()
+
+	PutEncoder(enc)
+
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+// AppendNil appends msgpack nil to b.
+func AppendNil(b []byte) []byte {
+	return append(b, msgpcode.Nil)
+}
+
+// AppendBool appends a msgpack bool to b.
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, msgpcode.True)
+	}
+	return append(b, msgpcode.False)
+}
+
+// AppendInt appends n to b in 1, 2, 3, 5, or 9 bytes like EncodeInt.
+func AppendInt(b []byte, n int64) []byte {
+	if n >= 0 {
+		return AppendUint(b, uint64(n))
+	}
+	if n >= int64(int8(msgpcode.NegFixedNumLow)) {
+		return append(b, byte(n))
+	}
+	if n >= math.MinInt8 {
+		return append1(b, msgpcode.Int8, uint8(n))
+	}
+	if n >= math.MinInt16 {
+		return append2(b, msgpcode.Int16, uint16(n))
+	}
+	if n >= math.MinInt32 {
+		return append4(b, msgpcode.Int32, uint32(n))
+	}
+	return append8(b, msgpcode.Int64, uint64(n))
+}
+
+// AppendUint appends n to b in 1, 2, 3, 5, or 9 bytes like EncodeUint.
+func AppendUint(b []byte, n uint64) []byte {
+	if n <= math.MaxInt8 {
+		return append(b, byte(n))
+	}
+	if n <= math.MaxUint8 {
+		return append1(b, msgpcode.Uint8, uint8(n))
+	}
+	if n <= math.MaxUint16 {
+		return append2(b, msgpcode.Uint16, uint16(n))
+	}
+	if n <= math.MaxUint32 {
+		return append4(b, msgpcode.Uint32, uint32(n))
+	}
+	return append8(b, msgpcode.Uint64, n)
+}
+
+// AppendInt64 appends n to b in 9 bytes like EncodeInt64.
+func AppendInt64(b []byte, n int64) []byte {
+	return append8(b, msgpcode.Int64, uint64(n))
+}
+
+// AppendUint64 appends n to b in 9 bytes like EncodeUint64.
+func AppendUint64(b []byte, n uint64) []byte {
+	return append8(b, msgpcode.Uint64, n)
+}
+
+// AppendFloat32 appends a msgpack float to b.
+func AppendFloat32(b []byte, n float32) []byte {
+	return append4(b, msgpcode.Float, math.Float32bits(n))
+}
+
+// AppendFloat64 appends a msgpack double to b.
+func AppendFloat64(b []byte, n float64) []byte {
+	return append8(b, msgpcode.Double, math.Float64bits(n))
+}
+
+// AppendStringLen appends the header of a string with length l to b.
+func AppendStringLen(b []byte, l int) []byte {
+	if l < 32 {
+		return append(b, msgpcode.FixedStrLow|byte(l))
+	}
+	if l < 256 {
+		return append1(b, msgpcode.Str8, uint8(l))
+	}
+	if l <= math.MaxUint16 {
+		return append2(b, msgpcode.Str16, uint16(l))
+	}
+	return append4(b, msgpcode.Str32, uint32(l))
+}
+
+// AppendString appends a msgpack string to b.
+func AppendString(b []byte, s string) []byte {
+	b = AppendStringLen(b, len(s))
+	return append(b, s...)
+}
+
+// AppendBytesLen appends the header of a bin with length l to b.
+func AppendBytesLen(b []byte, l int) []byte {
+	if l < 256 {
+		return append1(b, msgpcode.Bin8, uint8(l))
+	}
+	if l <= math.MaxUint16 {
+		return append2(b, msgpcode.Bin16, uint16(l))
+	}
+	return append4(b, msgpcode.Bin32, uint32(l))
+}
+
+// AppendBytes appends a msgpack bin to b. Nil v is appended as nil.
+func AppendBytes(b []byte, v []byte) []byte {
+	if v == nil {
+		return AppendNil(b)
+	}
+	b = AppendBytesLen(b, len(v))
+	return append(b, v...)
+}
+
+// AppendArrayLen appends the header of an array with l elements to b.
+func AppendArrayLen(b []byte, l int) []byte {
+	if l < 16 {
+		return append(b, msgpcode.FixedArrayLow|byte(l))
+	}
+	if l <= math.MaxUint16 {
+		return append2(b, msgpcode.Array16, uint16(l))
+	}
+	return append4(b, msgpcode.Array32, uint32(l))
+}
+
+// AppendMapLen appends the header of a map with l entries to b.
+func AppendMapLen(b []byte, l int) []byte {
+	if l < 16 {
+		return append(b, msgpcode.FixedMapLow|byte(l))
+	}
+	if l <= math.MaxUint16 {
+		return append2(b, msgpcode.Map16, uint16(l))
+	}
+	return append4(b, msgpcode.Map32, uint32(l))
+}
+
+func append1(b []byte, code byte, n uint8) []byte {
+	return append(b, code, n)
+}
+
+func append2(b []byte, code byte, n uint16) []byte {
+	return append(b, code, byte(n>>8), byte(n))
+}
+
+func append4(b []byte, code byte, n uint32) []byte {
+	return append(b, code, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func append8(b []byte, code byte, n uint64) []byte {
+	return append(b, code,
+		byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
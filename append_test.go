@@ -0,0 +1,103 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		b     []byte
+		value interface{}
+	}{
+		{msgpack.AppendNil(nil), nil},
+		{msgpack.AppendBool(nil, true), true},
+		{msgpack.AppendBool(nil, false), false},
+		{msgpack.AppendInt(nil, -1), int8(-1)},
+		{msgpack.AppendInt(nil, math.MinInt16), int16(math.MinInt16)},
+		{msgpack.AppendInt(nil, math.MinInt64), int64(math.MinInt64)},
+		{msgpack.AppendInt(nil, 200), uint8(200)},
+		{msgpack.AppendUint(nil, math.MaxUint32), uint32(math.MaxUint32)},
+		{msgpack.AppendUint(nil, math.MaxUint64), uint64(math.MaxUint64)},
+		{msgpack.AppendInt64(nil, 1), int64(1)},
+		{msgpack.AppendUint64(nil, 1), uint64(1)},
+		{msgpack.AppendFloat32(nil, 1.5), float32(1.5)},
+		{msgpack.AppendFloat64(nil, 1.5), 1.5},
+		{msgpack.AppendString(nil, "hello"), "hello"},
+		{msgpack.AppendString(nil, string(make([]byte, 300))), string(make([]byte, 300))},
+		{msgpack.AppendBytes(nil, []byte{1, 2}), []byte{1, 2}},
+		{msgpack.AppendBytes(nil, nil), nil},
+	}
+	for _, test := range tests {
+		var v interface{}
+		require.Nil(t, msgpack.Unmarshal(test.b, &v))
+		require.Equal(t, test.value, v)
+	}
+
+	for _, n := range []int{0, 15, 16, math.MaxUint16, math.MaxUint16 + 1} {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+
+		require.Nil(t, enc.EncodeArrayLen(n))
+		require.Equal(t, buf.Bytes(), msgpack.AppendArrayLen(nil, n))
+		buf.Reset()
+
+		require.Nil(t, enc.EncodeMapLen(n))
+		require.Equal(t, buf.Bytes(), msgpack.AppendMapLen(nil, n))
+		buf.Reset()
+
+		require.Nil(t, enc.EncodeBytesLen(n))
+		require.Equal(t, buf.Bytes(), msgpack.AppendBytesLen(nil, n))
+	}
+
+	b := msgpack.AppendMapLen([]byte("prefix"), 1)
+	b = msgpack.AppendString(b, "id")
+	b, err := msgpack.MarshalAppend(b, 42)
+	require.Nil(t, err)
+	require.Equal(t, "prefix", string(b[:6]))
+
+	var m map[string]int
+	require.Nil(t, msgpack.Unmarshal(b[6:], &m))
+	require.Equal(t, map[string]int{"id": 42}, m)
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestBufferedWrites(t *testing.T) {
+	var w countingWriter
+	enc := msgpack.NewEncoder(&w)
+	require.Nil(t, enc.UseBufferedWrites(true))
+
+	in := map[string]interface{}{"a": []int{1, 2, 3}, "b": "hello"}
+	require.Nil(t, enc.Encode(in))
+	require.Equal(t, 0, w.Len())
+
+	require.Nil(t, enc.Flush())
+	require.Equal(t, 1, w.writes)
+
+	require.Nil(t, enc.Encode(1))
+	require.Nil(t, enc.UseBufferedWrites(false))
+	require.Equal(t, 2, w.writes)
+
+	dec := msgpack.NewDecoder(&w.Buffer)
+	var out map[string]interface{}
+	require.Nil(t, dec.Decode(&out))
+	require.Equal(t, "hello", out["b"])
+	n, err := dec.DecodeInt()
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	require.Nil(t, enc.Flush())
+}
@@ -322,6 +322,61 @@ func BenchmarkStructUnmarshal(b *testing.B) {
 	}
 }
 
+func BenchmarkStructDecodeReader(b *testing.B) {
+	buf, err := msgpack.Marshal(structForBenchmark())
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := new(benchmarkStruct)
+	dec := msgpack.NewDecoder(nil)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.Reset(bytes.NewReader(buf))
+		if err := dec.Decode(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructDecodeBytes(b *testing.B) {
+	buf, err := msgpack.Marshal(structForBenchmark())
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := new(benchmarkStruct)
+	dec := msgpack.NewDecoder(nil)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.ResetBytes(buf)
+		if err := dec.Decode(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructDecodeBytesZeroCopy(b *testing.B) {
+	buf, err := msgpack.Marshal(structForBenchmark())
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := new(benchmarkStruct)
+	dec := msgpack.NewDecoder(nil)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.ResetBytes(buf)
+		dec.UseZeroCopy(true)
+		if err := dec.Decode(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkStructManual(b *testing.B) {
 	in := structForBenchmark2()
 	out := new(benchmarkStruct2)
@@ -395,3 +450,51 @@ func BenchmarkQuery(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkQueryCompiled(b *testing.B) {
+	var records []map[string]interface{}
+	for i := 0; i < 1000; i++ {
+		record := map[string]interface{}{
+			"id":    int64(i),
+			"attrs": map[string]interface{}{"phone": int64(i)},
+		}
+		records = append(records, record)
+	}
+
+	bs, err := msgpack.Marshal(records)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	q := msgpack.MustCompileQuery("10.attrs.phone")
+	dec := msgpack.NewDecoder(bytes.NewBuffer(bs))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.Reset(bytes.NewBuffer(bs))
+
+		values, err := dec.Run(q)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if values[0].(int64) != 10 {
+			b.Fatalf("%v != %d", values[0], 10)
+		}
+	}
+}
+
+func BenchmarkStructMarshalAppend(b *testing.B) {
+	in := structForBenchmark()
+	var buf []byte
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = msgpack.MarshalAppend(buf[:0], in)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
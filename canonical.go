@@ -0,0 +1,344 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// canonicalMaxDepth limits the nesting of arrays and maps accepted by
+// IsCanonical and Canonicalize.
+const canonicalMaxDepth = 10000
+
+// NonCanonicalError is returned by IsCanonical for input that is valid
+// MessagePack, but is not in the canonical form produced by
+// Encoder.UseCanonicalEncoding.
+type NonCanonicalError struct {
+	Offset int64  // offset of the first non-canonical value
+	Reason string // e.g. "map keys are not sorted"
+}
+
+func (err *NonCanonicalError) Error() string {
+	return fmt.Sprintf("msgpack: non-canonical encoding at offset %d: %s", err.Offset, err.Reason)
+}
+
+// IsCanonical reports whether data, a sequence of MessagePack values, is in
+// the canonical form produced by Encoder.UseCanonicalEncoding. When it is
+// not, the returned error is a *NonCanonicalError with the offset of the
+// first non-canonical value. Other errors mean that data is not valid
+// MessagePack. Extensions other than timestamps are not inspected.
+func IsCanonical(data []byte) (bool, error) {
+	c := newCanonicalizer(data, true)
+	for c.d.offset < int64(len(data)) {
+		if _, err := c.value(nil); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Canonicalize returns data, a sequence of MessagePack values, in the
+// canonical form produced by Encoder.UseCanonicalEncoding. It returns an
+// error if data is not valid MessagePack, contains a map with duplicate
+// keys or an invalid timestamp.
+func Canonicalize(data []byte) ([]byte, error) {
+	c := newCanonicalizer(data, false)
+	out := make([]byte, 0, len(data))
+	for c.d.offset < int64(len(data)) {
+		var err error
+		out, err = c.value(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type canonicalizer struct {
+	d     *Decoder
+	data  []byte
+	check bool   // report the first difference instead of normalising
+	buf   []byte // canonical encoding of the current header or scalar
+}
+
+func newCanonicalizer(data []byte, check bool) *canonicalizer {
+	d := new(Decoder)
+	d.ResetBytes(data)
+	d.SetLimits(Limits{MaxDepth: canonicalMaxDepth})
+	return &canonicalizer{
+		d:     d,
+		data:  data,
+		check: check,
+		buf:   make([]byte, 0, 16),
+	}
+}
+
+// emit appends the canonical encoding in c.buf of the input read since start.
+func (c *canonicalizer) emit(b []byte, start int64, reason string) ([]byte, error) {
+	if !c.check {
+		return append(b, c.buf...), nil
+	}
+	if !bytes.Equal(c.buf, c.data[start:c.d.offset]) {
+		return nil, &NonCanonicalError{Offset: start, Reason: reason}
+	}
+	return b, nil
+}
+
+// value appends the canonical encoding of the next value to b.
+//
+//nolint:gocyclo
+func (c *canonicalizer) value(b []byte) ([]byte, error) {
+	start := c.d.offset
+	code, err := c.d.readCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case msgpcode.IsFixedNum(code), code == msgpcode.Nil,
+		code == msgpcode.False, code == msgpcode.True:
+		c.buf = append(c.buf[:0], code)
+		return c.emit(b, start, "")
+	case msgpcode.IsFixedMap(code), code == msgpcode.Map16, code == msgpcode.Map32:
+		return c.mapValue(b, start, code)
+	case msgpcode.IsFixedArray(code), code == msgpcode.Array16, code == msgpcode.Array32:
+		return c.arrayValue(b, start, code)
+	case msgpcode.IsString(code), msgpcode.IsBin(code):
+		return c.bytesValue(b, start, code)
+	}
+
+	switch code {
+	case msgpcode.Uint8, msgpcode.Uint16, msgpcode.Uint32, msgpcode.Uint64:
+		n, err := c.d.uint(code)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = AppendUint(c.buf[:0], n)
+		return c.emit(b, start, "integer is not in the shortest form")
+	case msgpcode.Int8, msgpcode.Int16, msgpcode.Int32, msgpcode.Int64:
+		n, err := c.d.int(code)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = AppendInt(c.buf[:0], n)
+		return c.emit(b, start, "integer is not in the shortest form")
+	case msgpcode.Float:
+		n, err := c.d.float32(code)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = appendCanonicalFloat(c.buf[:0], float64(n))
+		return c.emit(b, start, "NaN is not the canonical NaN")
+	case msgpcode.Double:
+		n, err := c.d.float64(code)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = appendCanonicalFloat(c.buf[:0], n)
+		return c.emit(b, start, "float is not in the shortest form")
+	case msgpcode.FixExt1, msgpcode.FixExt2, msgpcode.FixExt4, msgpcode.FixExt8, msgpcode.FixExt16,
+		msgpcode.Ext8, msgpcode.Ext16, msgpcode.Ext32:
+		return c.extValue(b, start, code)
+	}
+
+	return nil, errors.Errorf("msgpack: unknown code %x", code)
+}
+
+func appendCanonicalFloat(b []byte, n float64) []byte {
+	if math.IsNaN(n) {
+		return append4(b, msgpcode.Float, canonicalNaN)
+	}
+	if float64(float32(n)) == n {
+		return append4(b, msgpcode.Float, math.Float32bits(float32(n)))
+	}
+	return append8(b, msgpcode.Double, math.Float64bits(n))
+}
+
+func (c *canonicalizer) bytesValue(b []byte, start int64, code byte) ([]byte, error) {
+	n, err := c.d.bytesLen(code)
+	if err != nil {
+		return nil, err
+	}
+	if msgpcode.IsBin(code) {
+		c.buf = AppendBytesLen(c.buf[:0], n)
+	} else {
+		c.buf = AppendStringLen(c.buf[:0], n)
+	}
+	if b, err = c.emit(b, start, "length is not in the shortest form"); err != nil {
+		return nil, err
+	}
+
+	data, err := c.d.readN(n)
+	if err != nil {
+		return nil, err
+	}
+	if c.check {
+		return b, nil
+	}
+	return append(b, data...), nil
+}
+
+func (c *canonicalizer) extValue(b []byte, start int64, code byte) ([]byte, error) {
+	extID, extLen, err := c.d.extHeader(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if extID == timeExtID {
+		// The default time encoding is replaced with the timestamp extension,
+		// which is what the Encoder writes in canonical mode.
+		tm, err := c.d.decodeTime(extLen)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = appendSpecTime(c.buf[:0], tm)
+		return c.emit(b, start, "time is not encoded as the timestamp extension")
+	}
+
+	data, err := c.d.readN(extLen)
+	if err != nil {
+		return nil, err
+	}
+
+	if extID == timeExtID2 {
+		tm, err := parseSpecTime(data)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = appendSpecTime(c.buf[:0], tm)
+		return c.emit(b, start, "timestamp is not in the shortest form")
+	}
+
+	c.buf = append(appendExtLen(c.buf[:0], extLen), byte(extID))
+	c.buf = append(c.buf, data...)
+	return c.emit(b, start, "ext length is not in the shortest form")
+}
+
+// parseSpecTime parses the data of the timestamp extension. Unlike
+// Decoder.decodeTime it rejects nanoseconds that overflow into seconds,
+// because normalising them would change the instant.
+func parseSpecTime(b []byte) (time.Time, error) {
+	var sec, nsec int64
+	switch len(b) {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(b))
+	case 8:
+		data := binary.BigEndian.Uint64(b)
+		sec = int64(data & 0x00000003ffffffff)
+		nsec = int64(data >> 34)
+	case 12:
+		nsec = int64(binary.BigEndian.Uint32(b))
+		sec = int64(binary.BigEndian.Uint64(b[4:]))
+	default:
+		return time.Time{}, errors.Errorf("msgpack: invalid timestamp length %d", len(b))
+	}
+	if nsec >= 1e9 {
+		return time.Time{}, errors.Errorf("msgpack: timestamp nanoseconds %d out of range", nsec)
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+func (c *canonicalizer) arrayValue(b []byte, start int64, code byte) ([]byte, error) {
+	n, err := c.d.arrayLen(code)
+	if err != nil {
+		return nil, err
+	}
+	c.buf = AppendArrayLen(c.buf[:0], n)
+	if b, err = c.emit(b, start, "array length is not in the shortest form"); err != nil {
+		return nil, err
+	}
+
+	if err := c.d.enter(); err != nil {
+		return nil, err
+	}
+	defer c.d.leave()
+
+	for i := 0; i < n; i++ {
+		if b, err = c.value(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+type canonicalEntry struct {
+	keyStart, keyEnd, end int
+}
+
+func (c *canonicalizer) mapValue(b []byte, start int64, code byte) ([]byte, error) {
+	n, err := c.d.mapLen(code)
+	if err != nil {
+		return nil, err
+	}
+	c.buf = AppendMapLen(c.buf[:0], n)
+	if b, err = c.emit(b, start, "map length is not in the shortest form"); err != nil {
+		return nil, err
+	}
+
+	if err := c.d.enter(); err != nil {
+		return nil, err
+	}
+	defer c.d.leave()
+
+	if c.check {
+		var prev []byte
+		for i := 0; i < n; i++ {
+			keyStart := c.d.offset
+			if _, err := c.value(nil); err != nil {
+				return nil, err
+			}
+			key := c.data[keyStart:c.d.offset]
+			if i > 0 {
+				switch cmp := bytes.Compare(prev, key); {
+				case cmp == 0:
+					return nil, &NonCanonicalError{Offset: keyStart, Reason: "duplicate map key"}
+				case cmp > 0:
+					return nil, &NonCanonicalError{Offset: keyStart, Reason: "map keys are not sorted"}
+				}
+			}
+			prev = key
+			if _, err := c.value(nil); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	// n comes from the input, so the entries are appended as they are read
+	// instead of being allocated up front.
+	var entries []byte
+	var list []canonicalEntry
+	for i := 0; i < n; i++ {
+		list = append(list, canonicalEntry{})
+		e := &list[i]
+		e.keyStart = len(entries)
+		if entries, err = c.value(entries); err != nil {
+			return nil, err
+		}
+		e.keyEnd = len(entries)
+		if entries, err = c.value(entries); err != nil {
+			return nil, err
+		}
+		e.end = len(entries)
+	}
+
+	key := func(e canonicalEntry) []byte {
+		return entries[e.keyStart:e.keyEnd]
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(key(list[i]), key(list[j])) < 0
+	})
+	for i, e := range list {
+		if i > 0 && bytes.Equal(key(list[i-1]), key(e)) {
+			return nil, errors.Errorf("msgpack: duplicate map key %x", key(e))
+		}
+		b = append(b, entries[e.keyStart:e.end]...)
+	}
+	return b, nil
+}
@@ -0,0 +1,141 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	type doc struct {
+		Name   string
+		Tags   map[string]int
+		Scores []float64
+		IDs    map[int64]bool
+		At     time.Time
+		Raw    msgpack.RawMessage
+	}
+	raw, err := msgpack.Marshal(map[string]interface{}{"z": uint64(1), "a": int64(-1)})
+	require.Nil(t, err)
+	v := doc{
+		Name:   "test",
+		Tags:   map[string]int{"b": 1, "a": 2, "long tag name": 3},
+		Scores: []float64{1.5, 0.1, -2},
+		IDs:    map[int64]bool{-1: true, 1: false, 1000: true},
+		At:     time.Unix(1600000000, 123),
+		Raw:    raw,
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCanonicalEncoding(true)
+	require.Nil(t, enc.Encode(&v))
+	canonical := buf.Bytes()
+
+	ok, err := msgpack.IsCanonical(canonical)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	b, err := msgpack.Marshal(&v)
+	require.Nil(t, err)
+	b, err = msgpack.Canonicalize(b)
+	require.Nil(t, err)
+	ok, err = msgpack.IsCanonical(b)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	b, err = msgpack.Canonicalize(canonical)
+	require.Nil(t, err)
+	require.Equal(t, canonical, b)
+
+	ok, err = msgpack.IsCanonical(nil)
+	require.Nil(t, err)
+	require.True(t, ok)
+}
+
+func TestIsCanonical(t *testing.T) {
+	tests := []struct {
+		in        string
+		offset    int64
+		reason    string
+		canonical string
+	}{
+		{"cd0001", 0, "integer is not in the shortest form", "01"},
+		{"d000", 0, "integer is not in the shortest form", "00"},
+		{"d3ffffffffffffffff", 0, "integer is not in the shortest form", "ff"},
+		{"cb3ff8000000000000", 0, "float is not in the shortest form", "ca3fc00000"},
+		{"cb7ff8000000000001", 0, "float is not in the shortest form", "ca7fc00000"},
+		{"ca7fc00001", 0, "NaN is not the canonical NaN", "ca7fc00000"},
+		{"d90161", 0, "length is not in the shortest form", "a161"},
+		{"c5000161", 0, "length is not in the shortest form", "c40161"},
+		{"dc000101", 0, "array length is not in the shortest form", "9101"},
+		{"de0000", 0, "map length is not in the shortest form", "80"},
+		{"9201cd0001", 2, "integer is not in the shortest form", "920101"},
+		{"82a16201a16102", 4, "map keys are not sorted", "82a16102a16201"},
+		{"82a2616101a16202", 5, "map keys are not sorted", "82a16202a2616101"},
+		{"c7010101", 0, "ext length is not in the shortest form", "d40101"},
+		{"d7ff0000000000000001", 0, "timestamp is not in the shortest form", "d6ff00000001"},
+		{"c70cff000000000000000000000001", 0, "timestamp is not in the shortest form", "d6ff00000001"},
+		{"c7090dcb408f400000000000", 0, "time is not encoded as the timestamp extension", "d6ff00000001"},
+		{"920dc7090dcb408f400000000000", 2, "time is not encoded as the timestamp extension", "920dd6ff00000001"},
+		// A sequence of values.
+		{"01cd0001", 1, "integer is not in the shortest form", "0101"},
+	}
+	for _, test := range tests {
+		in, err := hex.DecodeString(test.in)
+		require.Nil(t, err)
+
+		ok, err := msgpack.IsCanonical(in)
+		require.False(t, ok, test.in)
+		ncErr, isNC := err.(*msgpack.NonCanonicalError)
+		require.True(t, isNC, "%s: %v", test.in, err)
+		require.Equal(t, test.offset, ncErr.Offset, test.in)
+		require.Equal(t, test.reason, ncErr.Reason, test.in)
+
+		out, err := msgpack.Canonicalize(in)
+		require.Nil(t, err)
+		require.Equal(t, test.canonical, hex.EncodeToString(out), test.in)
+
+		ok, err = msgpack.IsCanonical(out)
+		require.Nil(t, err)
+		require.True(t, ok, test.canonical)
+	}
+
+	// Duplicate keys.
+	in, _ := hex.DecodeString("82a16101a16102")
+	ok, err := msgpack.IsCanonical(in)
+	require.False(t, ok)
+	require.Equal(t, int64(4), err.(*msgpack.NonCanonicalError).Offset)
+	_, err = msgpack.Canonicalize(in)
+	require.NotNil(t, err)
+
+	// Invalid input.
+	// Huge lengths are not allocated up front.
+	invalid := []string{"cd00", "92", "c1", "a261", "dfffffffff", "ddffffffff", "dfffffffff01"}
+	// Nanoseconds out of range.
+	invalid = append(invalid, "d7ffffffffff00000000", "c70cff3b9aca000000000000000001")
+	// Invalid timestamp length.
+	invalid = append(invalid, "d5ff0001")
+	for _, in := range invalid {
+		b, _ := hex.DecodeString(in)
+		ok, err := msgpack.IsCanonical(b)
+		require.False(t, ok)
+		require.NotNil(t, err)
+		_, isNC := err.(*msgpack.NonCanonicalError)
+		require.False(t, isNC, in)
+
+		_, err = msgpack.Canonicalize(b)
+		require.NotNil(t, err)
+	}
+
+	nested := bytes.Repeat([]byte{0x91}, 100000)
+	nested = append(nested, 0xc0)
+	_, err = msgpack.IsCanonical(nested)
+	require.NotNil(t, err)
+	_, ok = err.(*msgpack.LimitError)
+	require.True(t, ok, "%v", err)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+)
+
+func runPretty(c *cli, fs *flag.FlagSet, args []string) error {
+	jf := addJSONFlags(fs, "hex", "string")
+	indent := fs.String("indent", "  ", "indentation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opt, err := jf.options()
+	if err != nil {
+		return err
+	}
+
+	return c.eachInput(fs.Args(), func(name string, r io.Reader) error {
+		var buf bytes.Buffer
+		if err := opt.ToJSON(&buf, r); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+
+		// ToJSON writes every value on its own line.
+		var out bytes.Buffer
+		for _, line := range bytes.SplitAfter(buf.Bytes(), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			if err := json.Indent(&out, line, "", *indent); err != nil {
+				return err
+			}
+		}
+		_, err := c.stdout.Write(out.Bytes())
+		return err
+	})
+}
+
+func runJSON(c *cli, fs *flag.FlagSet, args []string) error {
+	jf := addJSONFlags(fs, "base64", "error")
+	reverse := fs.Bool("r", false, "convert JSON to MessagePack")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opt, err := jf.options()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	err = c.eachInput(fs.Args(), func(name string, r io.Reader) error {
+		var err error
+		if *reverse {
+			err = opt.FromJSON(w, r)
+		} else {
+			err = opt.ToJSON(w, r)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		return nil
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func runQuery(c *cli, fs *flag.FlagSet, args []string) error {
+	jf := addJSONFlags(fs, "base64", "string")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+	opt, err := jf.options()
+	if err != nil {
+		return err
+	}
+	q, err := msgpack.CompileQuery(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	err = c.eachInput(fs.Args()[1:], func(name string, r io.Reader) error {
+		br := bufio.NewReader(r)
+		dec := msgpack.NewDecoder(br)
+		dec.UseInternedStrings(opt.InternedStrings)
+		for {
+			if _, err := dec.PeekCode(); err == io.EOF {
+				return nil
+			}
+			values, err := queryValue(br, dec, q, opt.InternedStrings)
+			if err != nil {
+				return inputError(name, dec.InputOffset(), err)
+			}
+			// The matched values are printed with the same options as json.
+			for _, v := range values {
+				b, err := msgpack.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if err := opt.ToJSON(w, bytes.NewReader(b)); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// queryValue runs q on the next value of dec, which reads from br.
+func queryValue(br *bufio.Reader, dec *msgpack.Decoder, q *msgpack.Query, intern bool) ([]interface{}, error) {
+	if !intern {
+		return dec.Run(q)
+	}
+
+	// Run skips the values that don't match, so strings interned in them
+	// would be missing from the dictionary. Run the query on a copy of the
+	// value without interned strings instead.
+	b, err := plainValue(nil, br, dec, 0)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.NewDecoder(bytes.NewReader(b)).Run(q)
+}
+
+// plainValue appends the next value of dec, which reads from br, to b with
+// the interned strings resolved.
+func plainValue(b []byte, br *bufio.Reader, dec *msgpack.Decoder, depth int) ([]byte, error) {
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("exceeded max depth of %d", maxDepth)
+	}
+
+	c, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case msgpcode.IsString(c):
+		return appendDecodedString(b, dec)
+	case msgpcode.IsExt(c):
+		id, err := peekExtID(br, c)
+		if err != nil {
+			return nil, err
+		}
+		if id == internedStringExtID {
+			return appendDecodedString(b, dec)
+		}
+	case msgpcode.IsArray(c):
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		return plainValues(msgpack.AppendArrayLen(b, n), br, dec, n, depth)
+	case msgpcode.IsMap(c):
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		return plainValues(msgpack.AppendMapLen(b, n), br, dec, 2*n, depth)
+	}
+
+	raw, err := dec.DecodeRaw()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, raw...), nil
+}
+
+func plainValues(b []byte, br *bufio.Reader, dec *msgpack.Decoder, n, depth int) ([]byte, error) {
+	var err error
+	for i := 0; i < n; i++ {
+		if b, err = plainValue(b, br, dec, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendDecodedString(b []byte, dec *msgpack.Decoder) ([]byte, error) {
+	s, err := dec.DecodeString()
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.AppendString(b, s), nil
+}
+
+const internedStringExtID = -128
+
+// peekExtID returns the id of the extension starting with code c.
+func peekExtID(br *bufio.Reader, c byte) (int8, error) {
+	off := 1
+	switch c {
+	case msgpcode.Ext8:
+		off = 2
+	case msgpcode.Ext16:
+		off = 3
+	case msgpcode.Ext32:
+		off = 5
+	}
+	b, err := br.Peek(off + 1)
+	if err != nil {
+		return 0, err
+	}
+	return int8(b[off]), nil
+}
+
+func runValidate(c *cli, fs *flag.FlagSet, args []string) error {
+	var limits msgpack.Limits
+	fs.IntVar(&limits.MaxDepth, "max-depth", 1000, "maximum nesting depth; 0 means no limit")
+	fs.IntVar(&limits.MaxStringLen, "max-string", 0, "maximum string length in bytes")
+	fs.IntVar(&limits.MaxBinLen, "max-bin", 0, "maximum binary and extension data length in bytes")
+	fs.IntVar(&limits.MaxArrayLen, "max-array", 0, "maximum number of array elements")
+	fs.IntVar(&limits.MaxMapLen, "max-map", 0, "maximum number of map entries")
+	fs.Int64Var(&limits.MaxTotalBytes, "max-bytes", 0, "maximum input size in bytes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return c.eachInput(fs.Args(), func(name string, r io.Reader) error {
+		dec := msgpack.NewDecoder(r)
+		dec.SetLimits(limits)
+		n := 0
+		for {
+			if _, err := dec.PeekCode(); err == io.EOF {
+				break
+			}
+			if err := dec.Skip(); err != nil {
+				return inputError(name, dec.InputOffset(), err)
+			}
+			n++
+		}
+		fmt.Fprintf(c.stdout, "%s: ok, %d values, %d bytes\n", name, n, dec.InputOffset())
+		return nil
+	})
+}
+
+func runDiff(c *cli, fs *flag.FlagSet, args []string) error {
+	var opts msgpack.DiffOptions
+	fs.BoolVar(&opts.IgnoreKeyOrder, "ignore-key-order", false, "ignore the order of map keys")
+	fs.BoolVar(&opts.IgnoreNumericWidth, "ignore-width", false, "ignore the encoding width of numbers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+
+	var docs [2][]byte
+	for i := range docs {
+		err := c.eachInput(fs.Args()[i:i+1], func(name string, r io.Reader) error {
+			b, err := ioutil.ReadAll(r)
+			docs[i] = b
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	diffs, err := msgpack.DiffWithOptions(docs[0], docs[1], opts)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(c.stdout, d)
+	}
+	if len(diffs) > 0 {
+		return errDifferent
+	}
+	return nil
+}
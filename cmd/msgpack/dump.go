@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+)
+
+const (
+	// dumpMaxBytes is the number of bytes of a code shown by dump.
+	dumpMaxBytes = 8
+	// dumpMaxString is the number of bytes of a string or binary value
+	// shown by dump.
+	dumpMaxString = 32
+	// maxDepth limits the nesting of arrays and maps walked by dump.
+	maxDepth = 10000
+)
+
+func runDump(c *cli, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	err := c.eachInput(fs.Args(), func(name string, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		d := &dumper{
+			w:    w,
+			data: data,
+			dec:  msgpack.NewDecoder(nil),
+		}
+		d.dec.ResetBytes(data)
+
+		fmt.Fprintf(w, "# %s\n", name)
+		fmt.Fprintf(w, "%-8s %6s  %-*s  %s\n", "offset", "size", dumpMaxBytes*3+2, "bytes", "code")
+		for d.dec.InputOffset() < int64(len(data)) {
+			if err := d.value(0); err != nil {
+				return inputError(name, d.dec.InputOffset(), err)
+			}
+		}
+		return nil
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+type dumper struct {
+	w    io.Writer
+	data []byte
+	dec  *msgpack.Decoder
+}
+
+// line prints the code that starts at offset start and ends at the current
+// offset.
+func (d *dumper) line(start int64, depth int, desc string) {
+	b := d.data[start:d.dec.InputOffset()]
+	var hex strings.Builder
+	for i, c := range b {
+		if i == dumpMaxBytes {
+			hex.WriteString("..")
+			break
+		}
+		fmt.Fprintf(&hex, "%02x ", c)
+	}
+	fmt.Fprintf(d.w, "%08x %6d  %-*s  %s%s\n",
+		start, len(b), dumpMaxBytes*3+2, hex.String(), strings.Repeat("  ", depth), desc)
+}
+
+func (d *dumper) value(depth int) error {
+	if depth >= maxDepth {
+		return fmt.Errorf("exceeded max depth of %d", maxDepth)
+	}
+
+	start := d.dec.InputOffset()
+	c, err := d.dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	name := msgpcode.Name(c)
+
+	switch {
+	case msgpcode.IsArray(c):
+		n, err := d.dec.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		d.line(start, depth, fmt.Sprintf("%s len=%d", name, n))
+		for i := 0; i < n; i++ {
+			if err := d.value(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case msgpcode.IsMap(c):
+		n, err := d.dec.DecodeMapLen()
+		if err != nil {
+			return err
+		}
+		d.line(start, depth, fmt.Sprintf("%s len=%d", name, n))
+		for i := 0; i < 2*n; i++ {
+			if err := d.value(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case msgpcode.IsExt(c):
+		id, n, err := d.dec.DecodeExtHeader()
+		if err != nil {
+			return err
+		}
+		// n comes from the input, so it is checked before allocating.
+		if int64(n) > int64(len(d.data))-d.dec.InputOffset() {
+			return io.ErrUnexpectedEOF
+		}
+		if err := d.dec.ReadFull(make([]byte, n)); err != nil {
+			return err
+		}
+		d.line(start, depth, fmt.Sprintf("%s type=%d len=%d", name, id, n))
+		return nil
+	case msgpcode.IsString(c):
+		s, err := d.dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		d.line(start, depth, fmt.Sprintf("%s len=%d %s", name, len(s), quote(s)))
+		return nil
+	case msgpcode.IsBin(c):
+		b, err := d.dec.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		d.line(start, depth, fmt.Sprintf("%s len=%d %s", name, len(b), quote(string(b))))
+		return nil
+	case c == msgpcode.Nil, msgpcode.IsBool(c):
+		if err := d.dec.Skip(); err != nil {
+			return err
+		}
+		d.line(start, depth, name)
+		return nil
+	}
+
+	v, err := d.dec.DecodeInterface()
+	if err != nil {
+		return err
+	}
+	d.line(start, depth, fmt.Sprintf("%s %v", name, v))
+	return nil
+}
+
+// quote quotes s, shortened to dumpMaxString bytes.
+func quote(s string) string {
+	if len(s) > dumpMaxString {
+		return fmt.Sprintf("%q...", s[:dumpMaxString])
+	}
+	return fmt.Sprintf("%q", s)
+}
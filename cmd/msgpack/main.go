@@ -0,0 +1,211 @@
+// Msgpack inspects MessagePack data.
+//
+// Usage:
+//
+//	msgpack <command> [flags] [file...]
+//
+// The commands are:
+//
+//	dump      list every code with its offset, size and bytes
+//	pretty    print values as indented JSON
+//	json      convert MessagePack to JSON, or JSON to MessagePack with -r
+//	query     print the values matched by a Decoder.Query path
+//	validate  check that the input is well-formed and within limits
+//	diff      print the structural differences between two documents
+//
+// The input is read from the files given on the command line, or from the
+// standard input when there are none or the file name is "-". Every file may
+// contain a sequence of values. Run "msgpack <command> -h" for the flags of
+// a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gostudentorg/msgpack/v5/jsonx"
+)
+
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(c *cli, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []*command{
+	{"dump", "[file...]", "list every code with its offset, size and bytes", runDump},
+	{"pretty", "[flags] [file...]", "print values as indented JSON", runPretty},
+	{"json", "[flags] [file...]", "convert MessagePack to JSON, or JSON to MessagePack with -r", runJSON},
+	{"query", "[flags] path [file...]", "print the values matched by a Decoder.Query path", runQuery},
+	{"validate", "[flags] [file...]", "check that the input is well-formed and within limits", runValidate},
+	{"diff", "[flags] file1 file2", "print the structural differences between two documents", runDiff},
+}
+
+// cli holds the streams of a single invocation, so that it can be tested.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	c := &cli{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage of msgpack:\n")
+	fmt.Fprintf(c.stderr, "\tmsgpack <command> [flags] [file...]\n\n")
+	fmt.Fprintf(c.stderr, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "\t%-9s %s\n", cmd.name, cmd.short)
+	}
+}
+
+// run runs the command in args and returns the exit code.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(c.stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(c.stderr, "Usage of msgpack %s:\n", cmd.name)
+			fmt.Fprintf(c.stderr, "\tmsgpack %s %s\n", cmd.name, cmd.args)
+			fs.PrintDefaults()
+		}
+		err := cmd.run(c, fs, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case err == flag.ErrHelp:
+			return 2
+		case err == errDifferent:
+			return 1
+		case err == errUsage:
+			fs.Usage()
+			return 2
+		}
+		fmt.Fprintf(c.stderr, "msgpack %s: %s\n", cmd.name, err)
+		return 1
+	}
+
+	fmt.Fprintf(c.stderr, "msgpack: unknown command %q\n", args[0])
+	c.usage()
+	return 2
+}
+
+var (
+	errUsage = fmt.Errorf("invalid arguments")
+	// errDifferent makes diff exit with status 1 without a message.
+	errDifferent = fmt.Errorf("documents differ")
+)
+
+// eachInput calls fn with every input file named in names.
+func (c *cli) eachInput(names []string, fn func(name string, r io.Reader) error) error {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		if name == "-" {
+			if err := fn("<stdin>", c.stdin); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = fn(name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputError adds the input name and the offset to err.
+func inputError(name string, offset int64, err error) error {
+	return fmt.Errorf("%s: offset %d: %s", name, offset, err)
+}
+
+// jsonFlags are the flags that configure jsonx.Options.
+type jsonFlags struct {
+	bin    *string
+	ext    *string
+	time   *string
+	keys   *string
+	nan    *string
+	intern *bool
+}
+
+func addJSONFlags(fs *flag.FlagSet, bin, nan string) *jsonFlags {
+	return &jsonFlags{
+		bin:    fs.String("bin", bin, "binary data format: base64, hex or array"),
+		ext:    fs.String("ext", "object", "extension format: object, null or error"),
+		time:   fs.String("time", "rfc3339", "time format: rfc3339, millis or ext"),
+		keys:   fs.String("keys", "string", "non-string map keys: string or error"),
+		nan:    fs.String("nan", nan, "NaN and infinity format: error, null or string"),
+		intern: fs.Bool("intern", true, "resolve interned strings"),
+	}
+}
+
+func (f *jsonFlags) options() (jsonx.Options, error) {
+	// The values are listed in the order of the jsonx constants.
+	bin, err := parseEnum("bin", *f.bin, "base64", "hex", "array")
+	if err != nil {
+		return jsonx.Options{}, err
+	}
+	ext, err := parseEnum("ext", *f.ext, "object", "null", "error")
+	if err != nil {
+		return jsonx.Options{}, err
+	}
+	tm, err := parseEnum("time", *f.time, "rfc3339", "millis", "ext")
+	if err != nil {
+		return jsonx.Options{}, err
+	}
+	keys, err := parseEnum("keys", *f.keys, "string", "error")
+	if err != nil {
+		return jsonx.Options{}, err
+	}
+	nan, err := parseEnum("nan", *f.nan, "error", "null", "string")
+	if err != nil {
+		return jsonx.Options{}, err
+	}
+	return jsonx.Options{
+		Bin:             jsonx.BinFormat(bin),
+		Ext:             jsonx.ExtFormat(ext),
+		Time:            jsonx.TimeFormat(tm),
+		Keys:            jsonx.KeyFormat(keys),
+		NaN:             jsonx.NaNFormat(nan),
+		InternedStrings: *f.intern,
+	}, nil
+}
+
+// parseEnum returns the index of the value s of a flag in values.
+func parseEnum(flagName, s string, values ...string) (int, error) {
+	for i, v := range values {
+		if v == s {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid -%s %q: must be one of %s", flagName, s, strings.Join(values, ", "))
+}
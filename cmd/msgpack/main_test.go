@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func runCLI(t *testing.T, stdin []byte, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	c := &cli{
+		stdin:  bytes.NewReader(stdin),
+		stdout: &out,
+		stderr: &errOut,
+	}
+	code = c.run(args)
+	return code, out.String(), errOut.String()
+}
+
+func testInput(t *testing.T) []byte {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternedStrings(true)
+	enc.SetSortMapKeys(true)
+	require.Nil(t, enc.Encode(map[string]interface{}{
+		"items": []map[string]interface{}{
+			{"name": "apple", "qty": 300},
+			{"name": "apple", "qty": -1},
+		},
+	}))
+	require.Nil(t, enc.Encode(time.Unix(1, 0)))
+	return buf.Bytes()
+}
+
+func TestDump(t *testing.T) {
+	code, stdout, stderr := runCLI(t, testInput(t), "dump")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, `# <stdin>
+offset     size  bytes                       code
+00000000      1  81                          fixmap len=1
+00000001      6  a5 69 74 65 6d 73             fixstr len=5 "items"
+00000007      1  92                            fixarray len=2
+00000008      1  82                              fixmap len=2
+00000009      5  a4 6e 61 6d 65                    fixstr len=4 "name"
+0000000e      6  a5 61 70 70 6c 65                 fixstr len=5 "apple"
+00000014      4  a3 71 74 79                       fixstr len=3 "qty"
+00000018      3  cd 01 2c                          uint16 300
+0000001b      1  82                              fixmap len=2
+0000001c      3  d4 80 01                          fixext1 type=-128 len=1
+0000001f      3  d4 80 02                          fixext1 type=-128 len=1
+00000022      3  d4 80 03                          fixext1 type=-128 len=1
+00000025      1  ff                                negative fixint -1
+00000026     12  c7 09 0d cb 40 8f 40 00 ..  ext8 type=13 len=9
+`, stdout)
+
+	code, _, stderr = runCLI(t, []byte{0x92, 0x01}, "dump")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "<stdin>: offset 2: EOF")
+
+	code, _, stderr = runCLI(t, []byte{0xc9, 0xff, 0xff, 0xff, 0xff, 0x01}, "dump")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "<stdin>: offset 6: unexpected EOF")
+}
+
+func TestPrettyAndJSON(t *testing.T) {
+	in := testInput(t)
+
+	code, stdout, stderr := runCLI(t, in, "pretty", "-indent", " ")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, `{
+ "items": [
+  {
+   "name": "apple",
+   "qty": 300
+  },
+  {
+   "name": "apple",
+   "qty": -1
+  }
+ ]
+}
+"1970-01-01T00:00:01Z"
+`, stdout)
+
+	code, stdout, stderr = runCLI(t, in, "json", "-time", "millis")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, `{"items":[{"name":"apple","qty":300},{"name":"apple","qty":-1}]}
+1000
+`, stdout)
+
+	code, stdout, stderr = runCLI(t, []byte(stdout), "json", "-r")
+	require.Equal(t, 0, code, stderr)
+	var v map[string]interface{}
+	dec := msgpack.NewDecoder(strings.NewReader(stdout))
+	require.Nil(t, dec.Decode(&v))
+	require.Equal(t, "apple", v["items"].([]interface{})[1].(map[string]interface{})["name"])
+
+	code, _, stderr = runCLI(t, in, "json", "-nan", "maybe")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, `invalid -nan "maybe"`)
+}
+
+func TestQuery(t *testing.T) {
+	code, stdout, stderr := runCLI(t, testInput(t), "query", "items.*.qty")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, "300\n-1\n", stdout)
+
+	// The strings interned in the skipped values are resolved.
+	code, stdout, stderr = runCLI(t, testInput(t), "query", "items[-1].name")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, "\"apple\"\n", stdout)
+
+	code, _, _ = runCLI(t, nil, "query")
+	require.Equal(t, 2, code)
+}
+
+func TestValidate(t *testing.T) {
+	in := testInput(t)
+	code, stdout, stderr := runCLI(t, in, "validate")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, "<stdin>: ok, 2 values, 50 bytes\n", stdout)
+
+	code, _, stderr = runCLI(t, in, "validate", "-max-depth", "1")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "MaxDepth exceeded")
+
+	code, _, stderr = runCLI(t, in[:len(in)-1], "validate")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "EOF")
+
+	code, _, _ = runCLI(t, nil, "unknown")
+	require.Equal(t, 2, code)
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgpack")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// Structs keep the order of the keys, unlike maps.
+	a, err := msgpack.Marshal(struct {
+		ID   int    `msgpack:"id"`
+		Name string `msgpack:"name"`
+	}{ID: 1, Name: "a"})
+	require.Nil(t, err)
+	name := filepath.Join(dir, "a.msgpack")
+	require.Nil(t, ioutil.WriteFile(name, a, 0644))
+
+	code, stdout, stderr := runCLI(t, a, "diff", name, "-")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, "", stdout)
+
+	b, err := msgpack.Marshal(struct {
+		ID int64 `msgpack:"id"`
+	}{ID: 1})
+	require.Nil(t, err)
+	code, stdout, _ = runCLI(t, b, "diff", name, "-")
+	require.Equal(t, 1, code)
+	require.Equal(t, "id: width changed: 1 (positive fixint) != 1 (int64)\nname: removed \"a\" (fixstr)\n", stdout)
+
+	code, stdout, _ = runCLI(t, b, "diff", "-ignore-width", name, "-")
+	require.Equal(t, 1, code)
+	require.Equal(t, "name: removed \"a\" (fixstr)\n", stdout)
+
+	code, _, _ = runCLI(t, b, "diff", name)
+	require.Equal(t, 2, code)
+}
@@ -0,0 +1,739 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/tagparser/v2"
+)
+
+const defaultStructTag = "msgpack"
+
+// codecMethods are the methods that make the reflection-based encoder
+// use something other than the default struct codec.
+var codecMethods = []string{
+	"EncodeMsgpack", "DecodeMsgpack",
+	"MarshalMsgpack", "UnmarshalMsgpack",
+	"MarshalBinary", "UnmarshalBinary",
+	"MarshalText", "UnmarshalText",
+}
+
+// typeDecl is a type declared in the package.
+type typeDecl struct {
+	expr ast.Expr
+	file *ast.File
+}
+
+// method describes a method declared in the package.
+type method struct {
+	ptr bool // pointer receiver
+}
+
+type generator struct {
+	pkg     string
+	types   map[string]*typeDecl
+	methods map[string]map[string]method
+	gen     map[string]bool // types to generate methods for
+
+	buf bytes.Buffer
+}
+
+// fieldStep is a struct field on the path to an inlined field.
+type fieldStep struct {
+	name     string
+	ptr      bool
+	typeName string // type to allocate when ptr is set
+}
+
+type genField struct {
+	name      string
+	path      []fieldStep
+	typ       ast.Expr
+	file      *ast.File
+	omitEmpty bool
+	intern    bool
+}
+
+// genFields mirrors the fields cache of the msgpack package.
+type genFields struct {
+	list    []*genField
+	m       map[string]*genField
+	asArray bool
+}
+
+func (fs *genFields) add(f *genField) {
+	fs.m[f.name] = f
+	fs.list = append(fs.list, f)
+}
+
+func generate(dir string, typeNames, args []string) ([]byte, error) {
+	g, err := parsePackage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g.gen = make(map[string]bool, len(typeNames))
+	for _, name := range typeNames {
+		g.gen[name] = true
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by \"msgpackgen %s\"; DO NOT EDIT.\n\n", strings.Join(args, " "))
+	fmt.Fprintf(&g.buf, "package %s\n\n", g.pkg)
+	fmt.Fprintf(&g.buf, "import (\n")
+	fmt.Fprintf(&g.buf, "\t\"errors\"\n\n")
+	fmt.Fprintf(&g.buf, "\t\"github.com/gostudentorg/msgpack/v5\"\n")
+	fmt.Fprintf(&g.buf, "\t\"github.com/gostudentorg/msgpack/v5/msgpcode\"\n")
+	fmt.Fprintf(&g.buf, ")\n")
+
+	for _, name := range typeNames {
+		if err := g.generateType(name); err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("gofmt generated code: %s", err)
+	}
+	return src, nil
+}
+
+func parsePackage(dir string) (*generator, error) {
+	fset := token.NewFileSet()
+	filter := func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, "_msgpack.go")
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected 1 package in %s, found %d", dir, len(pkgs))
+	}
+
+	g := &generator{
+		types:   make(map[string]*typeDecl),
+		methods: make(map[string]map[string]method),
+	}
+
+	for name, pkg := range pkgs {
+		g.pkg = name
+
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						if spec, ok := spec.(*ast.TypeSpec); ok {
+							g.types[spec.Name.Name] = &typeDecl{expr: spec.Type, file: file}
+						}
+					}
+				case *ast.FuncDecl:
+					g.addMethod(decl)
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g *generator) addMethod(decl *ast.FuncDecl) {
+	if decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return
+	}
+
+	typ := decl.Recv.List[0].Type
+	var m method
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+		m.ptr = true
+	}
+	ident, ok := typ.(*ast.Ident)
+	if !ok {
+		return
+	}
+
+	if g.methods[ident.Name] == nil {
+		g.methods[ident.Name] = make(map[string]method)
+	}
+	g.methods[ident.Name][decl.Name.Name] = m
+}
+
+// ------------------------------------------------------------------------------
+
+// structType returns the local struct type named by expr.
+func (g *generator) structType(expr ast.Expr) (string, *ast.StructType, *ast.File, bool) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return "", nil, nil, false
+	}
+	decl, ok := g.types[ident.Name]
+	if !ok {
+		return "", nil, nil, false
+	}
+	st, ok := decl.expr.(*ast.StructType)
+	return ident.Name, st, decl.file, ok
+}
+
+// usesStructCodec reports whether the reflection-based encoder encodes
+// the local type name with the default struct codec.
+func (g *generator) usesStructCodec(name string) bool {
+	if g.gen[name] {
+		return false
+	}
+	for _, m := range codecMethods {
+		if _, ok := g.methods[name][m]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *generator) fields(name string, st *ast.StructType, file *ast.File) (*genFields, error) {
+	fs := &genFields{
+		m: make(map[string]*genField),
+	}
+
+	var omitEmpty bool
+	for _, field := range st.Fields.List {
+		var tagStr string
+		if field.Tag != nil {
+			s, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tagStr = reflect.StructTag(s).Get(defaultStructTag)
+		}
+		tag := tagparser.Parse(tagStr)
+		if tag.Name == "-" {
+			continue
+		}
+
+		names := field.Names
+		anonymous := len(names) == 0
+		if anonymous {
+			names = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+		}
+
+		for _, ident := range names {
+			if ident.Name == "_msgpack" {
+				fs.asArray = tag.HasOption("as_array") || tag.HasOption("asArray")
+				if tag.HasOption("omitempty") {
+					omitEmpty = true
+				}
+			}
+
+			if !ast.IsExported(ident.Name) && !anonymous {
+				continue
+			}
+
+			f := &genField{
+				name:      tag.Name,
+				path:      []fieldStep{{name: ident.Name}},
+				typ:       field.Type,
+				file:      file,
+				omitEmpty: omitEmpty || tag.HasOption("omitempty"),
+			}
+			if f.name == "" {
+				f.name = ident.Name
+			}
+
+			if tag.HasOption("intern") {
+				_, isInterface := g.underlying(field.Type).(*ast.InterfaceType)
+				if !isInterface && !g.isString(field.Type) {
+					return nil, fmt.Errorf("%s.%s: intern strings are not supported on %s",
+						name, ident.Name, types.ExprString(field.Type))
+				}
+				f.intern = true
+			}
+
+			if anonymous && !tag.HasOption("noinline") {
+				inline := tag.HasOption("inline")
+				if inline {
+					if err := g.inlineFields(fs, f); err != nil {
+						return nil, err
+					}
+				} else {
+					var err error
+					inline, err = g.shouldInline(fs, f)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				if inline {
+					fs.m[f.name] = f
+					continue
+				}
+			}
+
+			fs.add(f)
+
+			if alias, ok := tag.Options["alias"]; ok {
+				fs.m[alias] = f
+			}
+		}
+	}
+	return fs, nil
+}
+
+func (g *generator) inlineFields(fs *genFields, f *genField) error {
+	name, st, file, ok := g.structType(f.typ)
+	if !ok {
+		return fmt.Errorf("can't inline %s: not a struct declared in package %s",
+			types.ExprString(f.typ), g.pkg)
+	}
+
+	inlined, err := g.fields(name, st, file)
+	if err != nil {
+		return err
+	}
+	for _, field := range inlined.list {
+		if _, ok := fs.m[field.name]; ok {
+			// Don't inline shadowed fields.
+			continue
+		}
+		field.path = append(append([]fieldStep(nil), f.path...), field.path...)
+		fs.add(field)
+	}
+	return nil
+}
+
+func (g *generator) shouldInline(fs *genFields, f *genField) (bool, error) {
+	typ := f.typ
+	var ptr bool
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+		ptr = true
+	}
+
+	name, st, file, ok := g.structType(typ)
+	if !ok || !g.usesStructCodec(name) {
+		return false, nil
+	}
+
+	inlined, err := g.fields(name, st, file)
+	if err != nil {
+		return false, err
+	}
+	for _, field := range inlined.list {
+		if _, ok := fs.m[field.name]; ok {
+			// Don't auto inline if there are shadowed fields.
+			return false, nil
+		}
+	}
+
+	step := f.path[0]
+	step.ptr = ptr
+	step.typeName = name
+	for _, field := range inlined.list {
+		field.path = append([]fieldStep{step}, field.path...)
+		fs.add(field)
+	}
+	return true, nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	case *ast.Ident:
+		return expr.Name
+	}
+	return types.ExprString(expr)
+}
+
+// ------------------------------------------------------------------------------
+
+// underlying resolves local named types.
+func (g *generator) underlying(expr ast.Expr) ast.Expr {
+	for i := 0; i < 100; i++ {
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			return expr
+		}
+		decl, ok := g.types[ident.Name]
+		if !ok {
+			return expr
+		}
+		expr = decl.expr
+	}
+	return expr
+}
+
+func (g *generator) isString(expr ast.Expr) bool {
+	ident, ok := g.underlying(expr).(*ast.Ident)
+	return ok && ident.Name == "string"
+}
+
+func isTime(expr ast.Expr, file *ast.File) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Time" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if path != "time" {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name == pkg.Name
+		}
+		return pkg.Name == "time"
+	}
+	return false
+}
+
+func isBytes(expr ast.Expr) bool {
+	arr, ok := expr.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	elt, ok := arr.Elt.(*ast.Ident)
+	return ok && (elt.Name == "byte" || elt.Name == "uint8")
+}
+
+// isZeroer reports whether the local type name has an IsZero method
+// callable on a value (or on a pointer when ptr is set).
+func (g *generator) isZeroer(name string, ptr bool) bool {
+	m, ok := g.methods[name]["IsZero"]
+	return ok && (ptr || !m.ptr)
+}
+
+// present returns an expression that is true when x is not empty
+// according to the omitempty option, or "" when x is never empty.
+func (g *generator) present(x string, typ ast.Expr, file *ast.File) string {
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		switch typ.Name {
+		case "string":
+			return x + ` != ""`
+		case "bool":
+			return x
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"byte", "rune", "float32", "float64":
+			return x + " != 0"
+		case "error":
+			return "!msgpack.IsEmpty(" + x + ")"
+		}
+
+		if g.isZeroer(typ.Name, false) {
+			return "!" + x + ".IsZero()"
+		}
+		decl, ok := g.types[typ.Name]
+		if !ok {
+			return "!msgpack.IsEmpty(" + x + ")"
+		}
+		if _, ok := decl.expr.(*ast.StructType); ok {
+			return ""
+		}
+		return g.present(x, decl.expr, decl.file)
+	case *ast.StarExpr:
+		if ident, ok := typ.X.(*ast.Ident); ok {
+			if g.isZeroer(ident.Name, true) {
+				return x + " != nil && !" + x + ".IsZero()"
+			}
+			if _, ok := g.types[ident.Name]; ok {
+				return x + " != nil"
+			}
+		}
+		return "!msgpack.IsEmpty(" + x + ")"
+	case *ast.ArrayType, *ast.MapType:
+		return "len(" + x + ") != 0"
+	case *ast.SelectorExpr:
+		if isTime(typ, file) {
+			return "!" + x + ".IsZero()"
+		}
+		return "!msgpack.IsEmpty(" + x + ")"
+	case *ast.InterfaceType:
+		return "!msgpack.IsEmpty(" + x + ")"
+	case *ast.ParenExpr:
+		return g.present(x, typ.X, file)
+	}
+	// Structs, channels and funcs are never empty.
+	return ""
+}
+
+// ------------------------------------------------------------------------------
+
+func (g *generator) generateType(name string) error {
+	decl, ok := g.types[name]
+	if !ok {
+		return fmt.Errorf("type %s is not declared in package %s", name, g.pkg)
+	}
+	st, ok := decl.expr.(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct", name)
+	}
+
+	fs, err := g.fields(name, st, decl.file)
+	if err != nil {
+		return err
+	}
+
+	recv := strings.ToLower(name[:1])
+	switch recv {
+	case "c", "n", "i":
+		recv = "s"
+	}
+
+	g.printf("\nvar (\n")
+	g.printf("_ msgpack.CustomEncoder = (*%s)(nil)\n", name)
+	g.printf("_ msgpack.CustomDecoder = (*%s)(nil)\n", name)
+	g.printf(")\n")
+
+	g.printf("\n// EncodeMsgpack implements msgpack.CustomEncoder.\n")
+	g.printf("func (%s *%s) EncodeMsgpack(enc *msgpack.Encoder) error {\n", recv, name)
+	if fs.asArray {
+		g.encodeArray(recv, fs)
+	} else {
+		g.encodeMap(recv, fs)
+	}
+	g.printf("return nil\n}\n")
+
+	g.printf("\n// DecodeMsgpack implements msgpack.CustomDecoder.\n")
+	g.printf("func (%s *%s) DecodeMsgpack(dec *msgpack.Decoder) error {\n", recv, name)
+	g.decode(recv, name, fs)
+	g.printf("}\n")
+
+	return nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) returnIfErr(call string) {
+	g.printf("if err := %s; err != nil {\nreturn err\n}\n", call)
+}
+
+// access returns the expression of f and the nil checks of the pointers
+// on its path.
+func access(recv string, f *genField) (string, []string) {
+	x := recv
+	var checks []string
+	for i, step := range f.path {
+		x += "." + step.name
+		if step.ptr && i < len(f.path)-1 {
+			checks = append(checks, x+" != nil")
+		}
+	}
+	return x, checks
+}
+
+func (g *generator) encodeMap(recv string, fs *genFields) {
+	var n int
+	conds := make([]string, len(fs.list))
+	for i, f := range fs.list {
+		x, checks := access(recv, f)
+		if f.omitEmpty {
+			if cond := g.present(x, f.typ, f.file); cond != "" {
+				checks = append(checks, cond)
+			}
+		}
+		conds[i] = strings.Join(checks, " && ")
+		if conds[i] == "" {
+			n++
+		}
+	}
+
+	if n == len(fs.list) {
+		g.returnIfErr(fmt.Sprintf("enc.EncodeMapLen(%d)", n))
+	} else {
+		g.printf("n := %d\n", n)
+		for _, cond := range conds {
+			if cond != "" {
+				g.printf("if %s {\nn++\n}\n", cond)
+			}
+		}
+		g.returnIfErr("enc.EncodeMapLen(n)")
+	}
+
+	for i, f := range fs.list {
+		x, _ := access(recv, f)
+		if conds[i] != "" {
+			g.printf("if %s {\n", conds[i])
+		}
+		g.returnIfErr(fmt.Sprintf("enc.EncodeString(%q)", f.name))
+		g.returnIfErr(g.encodeCall(x, f))
+		if conds[i] != "" {
+			g.printf("}\n")
+		}
+	}
+}
+
+func (g *generator) encodeArray(recv string, fs *genFields) {
+	g.returnIfErr(fmt.Sprintf("enc.EncodeArrayLen(%d)", len(fs.list)))
+	for _, f := range fs.list {
+		x, checks := access(recv, f)
+		if len(checks) == 0 {
+			g.returnIfErr(g.encodeCall(x, f))
+			continue
+		}
+		g.printf("if %s {\n", strings.Join(checks, " && "))
+		g.returnIfErr(g.encodeCall(x, f))
+		g.printf("} else {\n")
+		g.returnIfErr("enc.EncodeNil()")
+		g.printf("}\n")
+	}
+}
+
+func (g *generator) encodeCall(x string, f *genField) string {
+	if f.intern {
+		if g.isString(f.typ) {
+			if ident, ok := f.typ.(*ast.Ident); ok && ident.Name == "string" {
+				return "enc.EncodeInternedString(" + x + ")"
+			}
+			return "enc.EncodeInternedString(string(" + x + "))"
+		}
+		return "enc.EncodeInternedInterface(" + x + ")"
+	}
+
+	if ident, ok := f.typ.(*ast.Ident); ok {
+		switch ident.Name {
+		case "string":
+			return "enc.EncodeString(" + x + ")"
+		case "bool":
+			return "enc.EncodeBool(" + x + ")"
+		case "int":
+			return "enc.EncodeInt(int64(" + x + "))"
+		case "uint":
+			return "enc.EncodeUint(uint64(" + x + "))"
+		case "float32":
+			return "enc.EncodeFloat32(" + x + ")"
+		case "float64":
+			return "enc.EncodeFloat64(" + x + ")"
+		case "int64", "uint64":
+			return "enc.Encode(" + x + ")"
+		}
+	}
+	if isBytes(f.typ) {
+		return "enc.EncodeBytes(" + x + ")"
+	}
+	if isTime(f.typ, f.file) {
+		return "enc.Encode(" + x + ")"
+	}
+	// Encode a pointer so that methods with pointer receivers are used.
+	return "enc.Encode(&" + x + ")"
+}
+
+func (g *generator) decode(recv, name string, fs *genFields) {
+	g.printf("c, err := dec.PeekCode()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+
+	g.printf("if msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32 {\n")
+	g.printf("n, err := dec.DecodeArrayLen()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("if n <= 0 {\n*%s = %s{}\nreturn nil\n}\n", recv, name)
+	g.printf("if n != %d {\n", len(fs.list))
+	g.printf("return errors.New(\"msgpack: number of fields in array-encoded struct has changed\")\n}\n")
+	for _, f := range fs.list {
+		g.decodeField(recv, f)
+		g.printf("if err != nil {\nreturn err\n}\n")
+	}
+	g.printf("return nil\n}\n\n")
+
+	g.printf("n, err := dec.DecodeMapLen()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("if n == -1 {\n*%s = %s{}\nreturn nil\n}\n", recv, name)
+	g.printf("for i := 0; i < n; i++ {\n")
+	g.printf("key, err := dec.DecodeKey()\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("switch key {\n")
+
+	keys := make(map[*genField][]string)
+	var order []*genField
+	names := make([]string, 0, len(fs.m))
+	for key := range fs.m {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		f := fs.m[key]
+		if keys[f] == nil {
+			order = append(order, f)
+		}
+		keys[f] = append(keys[f], strconv.Quote(key))
+	}
+	// Keep the declaration order of fields for readability.
+	index := make(map[*genField]int, len(fs.list))
+	for i, f := range fs.list {
+		index[f] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ii, iok := index[order[i]]
+		jj, jok := index[order[j]]
+		if iok != jok {
+			return iok
+		}
+		return ii < jj
+	})
+
+	for _, f := range order {
+		g.printf("case %s:\n", strings.Join(keys[f], ", "))
+		g.decodeField(recv, f)
+	}
+	g.printf("default:\nerr = dec.SkipUnknownField(key)\n}\n")
+	g.printf("if err != nil {\nreturn err\n}\n")
+	g.printf("}\n")
+	g.printf("return nil\n")
+}
+
+// decodeField decodes f and assigns the error to err.
+func (g *generator) decodeField(recv string, f *genField) {
+	x := recv
+	for i, step := range f.path {
+		x += "." + step.name
+		if step.ptr && i < len(f.path)-1 {
+			g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, step.typeName)
+		}
+	}
+
+	if f.intern {
+		if !g.isString(f.typ) {
+			g.printf("%s, err = dec.DecodeInternedInterface()\n", x)
+			return
+		}
+		if ident, ok := f.typ.(*ast.Ident); ok && ident.Name == "string" {
+			g.printf("%s, err = dec.DecodeInternedString()\n", x)
+			return
+		}
+		g.printf("{\nvar str string\nstr, err = dec.DecodeInternedString()\n%s = %s(str)\n}\n",
+			x, types.ExprString(f.typ))
+		return
+	}
+
+	if ident, ok := f.typ.(*ast.Ident); ok {
+		switch ident.Name {
+		case "string", "bool", "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+			g.printf("%s, err = dec.Decode%s%s()\n", x, strings.ToUpper(ident.Name[:1]), ident.Name[1:])
+			return
+		case "byte":
+			g.printf("%s, err = dec.DecodeUint8()\n", x)
+			return
+		case "rune":
+			g.printf("%s, err = dec.DecodeInt32()\n", x)
+			return
+		}
+	}
+	g.printf("err = dec.Decode(&%s)\n", x)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateIsUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	src, err := generate(dir, []string{"User", "Point", "Event"},
+		[]string{"-type=User,Point,Event", "-output=types_msgpack.go"})
+	require.Nil(t, err)
+
+	want, err := ioutil.ReadFile(filepath.Join(dir, "types_msgpack.go"))
+	require.Nil(t, err)
+	require.Equal(t, string(want), string(src), "run go generate ./cmd/msgpackgen/...")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+
+	_, err := generate(dir, []string{"Missing"}, nil)
+	require.EqualError(t, err, "type Missing is not declared in package gentest")
+
+	_, err = generate(dir, []string{"Status"}, nil)
+	require.EqualError(t, err, "type Status is not a struct")
+}
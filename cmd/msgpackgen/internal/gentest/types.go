@@ -0,0 +1,59 @@
+// Package gentest contains types with methods generated by msgpackgen.
+package gentest
+
+import "time"
+
+//go:generate go run github.com/gostudentorg/msgpack/v5/cmd/msgpackgen -type=User,Point,Event -output=types_msgpack.go
+
+type Status string
+
+type Base struct {
+	ID        int64     `msgpack:"id"`
+	CreatedAt time.Time `msgpack:"created_at,omitempty"`
+}
+
+type Meta struct {
+	Source string
+	Tags   map[string]string `msgpack:",omitempty"`
+}
+
+type Extra struct {
+	Note string
+}
+
+type User struct {
+	Base
+	*Meta
+	Extra `msgpack:",noinline"`
+
+	Name     string      `msgpack:"name,alias:full_name"`
+	Email    string      `msgpack:"email,omitempty"`
+	Age      int         `msgpack:"age,omitempty"`
+	Score    float64     `msgpack:"score"`
+	Level    int8        `msgpack:"level"`
+	Active   bool        `msgpack:"active,omitempty"`
+	Status   Status      `msgpack:"status,intern"`
+	Country  string      `msgpack:"country,intern"`
+	Label    interface{} `msgpack:"label,intern,omitempty"`
+	Avatar   []byte      `msgpack:"avatar"`
+	Friends  []string    `msgpack:"friends,omitempty"`
+	Location *Point      `msgpack:"location,omitempty"`
+	Secret   string      `msgpack:"-"`
+
+	hidden int
+}
+
+type Point struct {
+	_msgpack struct{} `msgpack:",as_array"`
+
+	X, Y float32
+}
+
+type Event struct {
+	_msgpack struct{} `msgpack:",omitempty"`
+
+	Name    string
+	At      time.Time
+	Payload map[string]interface{}
+	Points  []Point
+}
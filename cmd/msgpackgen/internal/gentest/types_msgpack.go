@@ -0,0 +1,545 @@
+// Code generated by "msgpackgen -type=User,Point,Event -output=types_msgpack.go"; DO NOT EDIT.
+
+package gentest
+
+import (
+	"errors"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+)
+
+var (
+	_ msgpack.CustomEncoder = (*User)(nil)
+	_ msgpack.CustomDecoder = (*User)(nil)
+)
+
+// EncodeMsgpack implements msgpack.CustomEncoder.
+func (u *User) EncodeMsgpack(enc *msgpack.Encoder) error {
+	n := 8
+	if !u.Base.CreatedAt.IsZero() {
+		n++
+	}
+	if u.Meta != nil {
+		n++
+	}
+	if u.Meta != nil && len(u.Meta.Tags) != 0 {
+		n++
+	}
+	if u.Email != "" {
+		n++
+	}
+	if u.Age != 0 {
+		n++
+	}
+	if u.Active {
+		n++
+	}
+	if !msgpack.IsEmpty(u.Label) {
+		n++
+	}
+	if len(u.Friends) != 0 {
+		n++
+	}
+	if u.Location != nil {
+		n++
+	}
+	if err := enc.EncodeMapLen(n); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("id"); err != nil {
+		return err
+	}
+	if err := enc.Encode(u.Base.ID); err != nil {
+		return err
+	}
+	if !u.Base.CreatedAt.IsZero() {
+		if err := enc.EncodeString("created_at"); err != nil {
+			return err
+		}
+		if err := enc.Encode(u.Base.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if u.Meta != nil {
+		if err := enc.EncodeString("Source"); err != nil {
+			return err
+		}
+		if err := enc.EncodeString(u.Meta.Source); err != nil {
+			return err
+		}
+	}
+	if u.Meta != nil && len(u.Meta.Tags) != 0 {
+		if err := enc.EncodeString("Tags"); err != nil {
+			return err
+		}
+		if err := enc.Encode(&u.Meta.Tags); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeString("Extra"); err != nil {
+		return err
+	}
+	if err := enc.Encode(&u.Extra); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("name"); err != nil {
+		return err
+	}
+	if err := enc.EncodeString(u.Name); err != nil {
+		return err
+	}
+	if u.Email != "" {
+		if err := enc.EncodeString("email"); err != nil {
+			return err
+		}
+		if err := enc.EncodeString(u.Email); err != nil {
+			return err
+		}
+	}
+	if u.Age != 0 {
+		if err := enc.EncodeString("age"); err != nil {
+			return err
+		}
+		if err := enc.EncodeInt(int64(u.Age)); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeString("score"); err != nil {
+		return err
+	}
+	if err := enc.EncodeFloat64(u.Score); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("level"); err != nil {
+		return err
+	}
+	if err := enc.Encode(&u.Level); err != nil {
+		return err
+	}
+	if u.Active {
+		if err := enc.EncodeString("active"); err != nil {
+			return err
+		}
+		if err := enc.EncodeBool(u.Active); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeString("status"); err != nil {
+		return err
+	}
+	if err := enc.EncodeInternedString(string(u.Status)); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("country"); err != nil {
+		return err
+	}
+	if err := enc.EncodeInternedString(u.Country); err != nil {
+		return err
+	}
+	if !msgpack.IsEmpty(u.Label) {
+		if err := enc.EncodeString("label"); err != nil {
+			return err
+		}
+		if err := enc.EncodeInternedInterface(u.Label); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeString("avatar"); err != nil {
+		return err
+	}
+	if err := enc.EncodeBytes(u.Avatar); err != nil {
+		return err
+	}
+	if len(u.Friends) != 0 {
+		if err := enc.EncodeString("friends"); err != nil {
+			return err
+		}
+		if err := enc.Encode(&u.Friends); err != nil {
+			return err
+		}
+	}
+	if u.Location != nil {
+		if err := enc.EncodeString("location"); err != nil {
+			return err
+		}
+		if err := enc.Encode(&u.Location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeMsgpack implements msgpack.CustomDecoder.
+func (u *User) DecodeMsgpack(dec *msgpack.Decoder) error {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32 {
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			*u = User{}
+			return nil
+		}
+		if n != 17 {
+			return errors.New("msgpack: number of fields in array-encoded struct has changed")
+		}
+		u.Base.ID, err = dec.DecodeInt64()
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&u.Base.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if u.Meta == nil {
+			u.Meta = new(Meta)
+		}
+		u.Meta.Source, err = dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		if u.Meta == nil {
+			u.Meta = new(Meta)
+		}
+		err = dec.Decode(&u.Meta.Tags)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&u.Extra)
+		if err != nil {
+			return err
+		}
+		u.Name, err = dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		u.Email, err = dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		u.Age, err = dec.DecodeInt()
+		if err != nil {
+			return err
+		}
+		u.Score, err = dec.DecodeFloat64()
+		if err != nil {
+			return err
+		}
+		u.Level, err = dec.DecodeInt8()
+		if err != nil {
+			return err
+		}
+		u.Active, err = dec.DecodeBool()
+		if err != nil {
+			return err
+		}
+		{
+			var str string
+			str, err = dec.DecodeInternedString()
+			u.Status = Status(str)
+		}
+		if err != nil {
+			return err
+		}
+		u.Country, err = dec.DecodeInternedString()
+		if err != nil {
+			return err
+		}
+		u.Label, err = dec.DecodeInternedInterface()
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&u.Avatar)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&u.Friends)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&u.Location)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		*u = User{}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "id":
+			u.Base.ID, err = dec.DecodeInt64()
+		case "created_at":
+			err = dec.Decode(&u.Base.CreatedAt)
+		case "Source":
+			if u.Meta == nil {
+				u.Meta = new(Meta)
+			}
+			u.Meta.Source, err = dec.DecodeString()
+		case "Tags":
+			if u.Meta == nil {
+				u.Meta = new(Meta)
+			}
+			err = dec.Decode(&u.Meta.Tags)
+		case "Extra":
+			err = dec.Decode(&u.Extra)
+		case "full_name", "name":
+			u.Name, err = dec.DecodeString()
+		case "email":
+			u.Email, err = dec.DecodeString()
+		case "age":
+			u.Age, err = dec.DecodeInt()
+		case "score":
+			u.Score, err = dec.DecodeFloat64()
+		case "level":
+			u.Level, err = dec.DecodeInt8()
+		case "active":
+			u.Active, err = dec.DecodeBool()
+		case "status":
+			{
+				var str string
+				str, err = dec.DecodeInternedString()
+				u.Status = Status(str)
+			}
+		case "country":
+			u.Country, err = dec.DecodeInternedString()
+		case "label":
+			u.Label, err = dec.DecodeInternedInterface()
+		case "avatar":
+			err = dec.Decode(&u.Avatar)
+		case "friends":
+			err = dec.Decode(&u.Friends)
+		case "location":
+			err = dec.Decode(&u.Location)
+		case "Base":
+			err = dec.Decode(&u.Base)
+		case "Meta":
+			err = dec.Decode(&u.Meta)
+		default:
+			err = dec.SkipUnknownField(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	_ msgpack.CustomEncoder = (*Point)(nil)
+	_ msgpack.CustomDecoder = (*Point)(nil)
+)
+
+// EncodeMsgpack implements msgpack.CustomEncoder.
+func (p *Point) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeArrayLen(2); err != nil {
+		return err
+	}
+	if err := enc.EncodeFloat32(p.X); err != nil {
+		return err
+	}
+	if err := enc.EncodeFloat32(p.Y); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeMsgpack implements msgpack.CustomDecoder.
+func (p *Point) DecodeMsgpack(dec *msgpack.Decoder) error {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32 {
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			*p = Point{}
+			return nil
+		}
+		if n != 2 {
+			return errors.New("msgpack: number of fields in array-encoded struct has changed")
+		}
+		p.X, err = dec.DecodeFloat32()
+		if err != nil {
+			return err
+		}
+		p.Y, err = dec.DecodeFloat32()
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		*p = Point{}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "X":
+			p.X, err = dec.DecodeFloat32()
+		case "Y":
+			p.Y, err = dec.DecodeFloat32()
+		default:
+			err = dec.SkipUnknownField(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	_ msgpack.CustomEncoder = (*Event)(nil)
+	_ msgpack.CustomDecoder = (*Event)(nil)
+)
+
+// EncodeMsgpack implements msgpack.CustomEncoder.
+func (e *Event) EncodeMsgpack(enc *msgpack.Encoder) error {
+	n := 0
+	if e.Name != "" {
+		n++
+	}
+	if !e.At.IsZero() {
+		n++
+	}
+	if len(e.Payload) != 0 {
+		n++
+	}
+	if len(e.Points) != 0 {
+		n++
+	}
+	if err := enc.EncodeMapLen(n); err != nil {
+		return err
+	}
+	if e.Name != "" {
+		if err := enc.EncodeString("Name"); err != nil {
+			return err
+		}
+		if err := enc.EncodeString(e.Name); err != nil {
+			return err
+		}
+	}
+	if !e.At.IsZero() {
+		if err := enc.EncodeString("At"); err != nil {
+			return err
+		}
+		if err := enc.Encode(e.At); err != nil {
+			return err
+		}
+	}
+	if len(e.Payload) != 0 {
+		if err := enc.EncodeString("Payload"); err != nil {
+			return err
+		}
+		if err := enc.Encode(&e.Payload); err != nil {
+			return err
+		}
+	}
+	if len(e.Points) != 0 {
+		if err := enc.EncodeString("Points"); err != nil {
+			return err
+		}
+		if err := enc.Encode(&e.Points); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeMsgpack implements msgpack.CustomDecoder.
+func (e *Event) DecodeMsgpack(dec *msgpack.Decoder) error {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32 {
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			*e = Event{}
+			return nil
+		}
+		if n != 4 {
+			return errors.New("msgpack: number of fields in array-encoded struct has changed")
+		}
+		e.Name, err = dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&e.At)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&e.Payload)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&e.Points)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		*e = Event{}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "Name":
+			e.Name, err = dec.DecodeString()
+		case "At":
+			err = dec.Decode(&e.At)
+		case "Payload":
+			err = dec.Decode(&e.Payload)
+		case "Points":
+			err = dec.Decode(&e.Points)
+		default:
+			err = dec.SkipUnknownField(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package gentest_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/cmd/msgpackgen/internal/gentest"
+	"github.com/stretchr/testify/require"
+)
+
+// Conversions to these types drop the generated methods,
+// so they are encoded with reflection.
+type (
+	reflectUser  gentest.User
+	reflectEvent gentest.Event
+)
+
+func testUser() *gentest.User {
+	u := &gentest.User{
+		Name:     "Alice",
+		Email:    "alice@example.com",
+		Score:    9.5,
+		Level:    -3,
+		Active:   true,
+		Status:   "active",
+		Country:  "active",
+		Label:    "active",
+		Avatar:   []byte{1, 2, 3},
+		Friends:  []string{"bob"},
+		Location: &gentest.Point{X: 1, Y: 2},
+	}
+	u.ID = 42
+	u.CreatedAt = time.Unix(1600000000, 0)
+	u.Meta = &gentest.Meta{Source: "web", Tags: map[string]string{"a": "b"}}
+	u.Extra.Note = "note"
+	return u
+}
+
+func TestGeneratedMatchesReflection(t *testing.T) {
+	users := []*gentest.User{testUser(), {}}
+	for _, u := range users {
+		got, err := msgpack.Marshal(u)
+		require.Nil(t, err)
+		want, err := msgpack.Marshal((*reflectUser)(u))
+		require.Nil(t, err)
+		require.Equal(t, want, got)
+
+		var out gentest.User
+		require.Nil(t, msgpack.Unmarshal(want, &out))
+		var reflectOut reflectUser
+		require.Nil(t, msgpack.Unmarshal(got, &reflectOut))
+		require.Equal(t, gentest.User(reflectOut), out)
+	}
+
+	events := []*gentest.Event{
+		{Name: "click", At: time.Unix(1600000000, 0), Payload: map[string]interface{}{"x": int8(1)}},
+		{Points: []gentest.Point{{X: 1}, {Y: 2}}},
+	}
+	for _, e := range events {
+		got, err := msgpack.Marshal(e)
+		require.Nil(t, err)
+		want, err := msgpack.Marshal((*reflectEvent)(e))
+		require.Nil(t, err)
+		require.Equal(t, want, got)
+	}
+}
+
+func TestGeneratedDecode(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"full_name": "Bob",
+		"Source":    "api",
+		"unknown":   []int{1, 2},
+	})
+	require.Nil(t, err)
+
+	var u gentest.User
+	require.Nil(t, msgpack.Unmarshal(b, &u))
+	require.Equal(t, "Bob", u.Name)
+	require.Equal(t, "api", u.Meta.Source)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseArrayEncodedStructs(true)
+	require.Nil(t, enc.Encode((*reflectUser)(testUser())))
+
+	u = gentest.User{}
+	require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &u))
+	require.Equal(t, "alice@example.com", u.Email)
+	require.Equal(t, "web", u.Meta.Source)
+
+	require.Nil(t, msgpack.Unmarshal([]byte{0xc0}, &u))
+	require.Equal(t, gentest.User{}, u)
+
+	err = msgpack.Unmarshal([]byte{0x91, 0x01}, &u)
+	require.NotNil(t, err)
+}
+
+func TestGeneratedDisallowUnknownFields(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{"unknown": []int{1, 2}})
+	require.Nil(t, err)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields(true)
+	var u gentest.User
+	err = dec.Decode(&u)
+	require.NotNil(t, err)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields(true)
+	var reflectOut reflectUser
+	wantErr := dec.Decode(&reflectOut)
+	require.NotNil(t, wantErr)
+	require.Equal(t, wantErr.Error(), err.Error())
+}
+
+func BenchmarkGeneratedMarshal(b *testing.B) {
+	u := testUser()
+	for i := 0; i < b.N; i++ {
+		if _, err := msgpack.Marshal(u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReflectMarshal(b *testing.B) {
+	u := (*reflectUser)(testUser())
+	for i := 0; i < b.N; i++ {
+		if _, err := msgpack.Marshal(u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGeneratedUnmarshal(b *testing.B) {
+	data, err := msgpack.Marshal(testUser())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var u gentest.User
+		if err := msgpack.Unmarshal(data, &u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReflectUnmarshal(b *testing.B) {
+	data, err := msgpack.Marshal(testUser())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var u reflectUser
+		if err := msgpack.Unmarshal(data, &u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Msgpackgen generates EncodeMsgpack and DecodeMsgpack methods for Go structs,
+// so they are encoded without reflection.
+//
+// Usage:
+//
+//	msgpackgen -type=User,Order [-output=file.go] [dir]
+//
+// It is meant to be used with go generate:
+//
+//	//go:generate msgpackgen -type=User
+//
+// The generated methods produce the same encoding as the reflection-based
+// encoder and honour the omitempty, as_array, alias, intern, inline and
+// noinline options of the msgpack struct tag. They implement
+// msgpack.CustomEncoder and msgpack.CustomDecoder, so the options set with
+// Encoder.UseArrayEncodedStructs, Encoder.SetOmitEmpty and
+// Encoder.SetCustomStructTag do not apply. Decoder.DisallowUnknownFields
+// is honoured.
+// Embedded structs from other packages are encoded as nested values.
+//
+// By default the methods are written to <type>_msgpack.go in the package
+// directory, where <type> is the first type name in lower case. Files ending
+// with _msgpack.go are ignored when reading the package.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; must be set")
+	output    = flag.String("output", "", "output file name; default <dir>/<type>_msgpack.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of msgpackgen:\n")
+	fmt.Fprintf(os.Stderr, "\tmsgpackgen -type=T[,T...] [-output=file.go] [dir]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	src, err := generate(dir, types, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "msgpackgen: %s\n", err)
+		os.Exit(1)
+	}
+
+	name := *output
+	if name == "" {
+		name = filepath.Join(dir, strings.ToLower(types[0])+"_msgpack.go")
+	}
+	if err := ioutil.WriteFile(name, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "msgpackgen: %s\n", err)
+		os.Exit(1)
+	}
+}
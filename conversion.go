@@ -1,350 +1,436 @@
 package msgpack
 
 import (
+	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	"gitlab.gostudent.cloud/pkg/log"
-	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// ConversionReason explains why a conversion failed or lost information.
+type ConversionReason int
+
+const (
+	// ConversionOverflow means the value does not fit into the target type.
+	ConversionOverflow ConversionReason = iota + 1
+	// ConversionInvalidSyntax means a string can't be parsed as the target type.
+	ConversionInvalidSyntax
+	// ConversionPrecisionLoss means the value was converted, but part of it
+	// (e.g. a fraction) was lost.
+	ConversionPrecisionLoss
+	// ConversionUnsupportedType means the source type can't be converted at all.
+	ConversionUnsupportedType
+)
+
+func (r ConversionReason) String() string {
+	switch r {
+	case ConversionOverflow:
+		return "overflow"
+	case ConversionInvalidSyntax:
+		return "invalid syntax"
+	case ConversionPrecisionLoss:
+		return "precision loss"
+	case ConversionUnsupportedType:
+		return "unsupported type"
+	}
+	return "unknown reason"
+}
+
+// ConversionError is returned by the To*E helpers when a value can't be converted
+// to the target type without losing information.
+type ConversionError struct {
+	From   reflect.Type // nil when Value is nil
+	To     reflect.Type
+	Value  interface{}
+	Reason ConversionReason
+	// Err is the error of the underlying parser, e.g. time.Parse, if any.
+	Err error
+}
+
+func newConversionError(v interface{}, to reflect.Type, reason ConversionReason) *ConversionError {
+	return &ConversionError{
+		From:   reflect.TypeOf(v),
+		To:     to,
+		Value:  v,
+		Reason: reason,
+	}
+}
+
+func (err *ConversionError) Error() string {
+	msg := fmt.Sprintf("msgpack: converting %v (%s) to %s: %s", err.Value, err.From, err.To, err.Reason)
+	if err.Err != nil {
+		msg += ": " + err.Err.Error()
+	}
+	return msg
+}
+
+// lossy reports whether the conversion produced a value, though not an exact one.
+func (err *ConversionError) lossy() bool {
+	return err.Reason == ConversionOverflow || err.Reason == ConversionPrecisionLoss
+}
+
+func logConversionError(err error) {
+	if convErr, ok := err.(*ConversionError); ok && convErr.lossy() {
+		log.Debug().Err(err, "")
+		return
+	}
+	log.Warn().Err(err, "")
+}
+
+var (
+	intType     = reflect.TypeOf(int(0))
+	int64Type   = reflect.TypeOf(int64(0))
+	uint64Type  = reflect.TypeOf(uint64(0))
+	float64Type = reflect.TypeOf(float64(0))
+	boolType    = reflect.TypeOf(false)
+	timeType    = reflect.TypeOf(time.Time{})
 )
 
 // ToInt converts a number to an integer value.
 func ToInt(i interface{}) int {
-	switch v := i.(type) {
-	case nil:
-		return 0
-	case int:
-		return v
-	case int8:
-		return int(v)
-	case int16:
-		return int(v)
-	case int32:
-		return int(v)
-	case int64:
-		return int(v)
-	case uint8:
-		return int(v)
-	case uint16:
-		return int(v)
-	case uint32:
-		return int(v)
-	case uint64:
-		log.Debug().Err(errors.New("ToInt: lossy conversion from uint64"), "")
-		return int(v)
-	case float32:
-		return int(v)
-	case float64:
-		return int(v)
-	case string:
-		val, err := stringToInt64(v)
-		if err != nil {
-			log.Warn().Err(errors.Errorf("ToInt: string '%s' is not a number", v), "")
-			return 0
-		}
-		return int(val)
-	case bool:
-		if v {
-			return 1
+	n, err := ToIntE(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return n
+}
+
+// ToIntE is like ToInt, but returns a *ConversionError when the conversion fails
+// or loses information. The returned value is the same as ToInt returns.
+func ToIntE(i interface{}) (int, error) {
+	n, err := ToInt64E(i)
+	if err != nil {
+		if convErr, ok := err.(*ConversionError); ok {
+			convErr.To = intType
 		}
-		return 0
-	default:
-		log.Warn().Err(errors.Errorf("ToInt: type %T not implemented", i), "")
+		return int(n), err
 	}
-	return 0
+	if int64(int(n)) != n {
+		return int(n), newConversionError(i, intType, ConversionOverflow)
+	}
+	return int(n), nil
 }
 
 // ToInt64 converts a number to an int64 value.
 func ToInt64(i interface{}) int64 {
+	n, err := ToInt64E(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return n
+}
+
+// ToInt64E is like ToInt64, but returns a *ConversionError when the conversion fails
+// or loses information. The returned value is the same as ToInt64 returns.
+func ToInt64E(i interface{}) (int64, error) {
 	switch v := i.(type) {
 	case nil:
-		return 0
+		return 0, nil
 	case int:
-		return int64(v)
+		return int64(v), nil
 	case int8:
-		return int64(v)
+		return int64(v), nil
 	case int16:
-		return int64(v)
+		return int64(v), nil
 	case int32:
-		return int64(v)
+		return int64(v), nil
 	case int64:
-		return v
+		return v, nil
 	case uint8:
-		return int64(v)
+		return int64(v), nil
 	case uint16:
-		return int64(v)
+		return int64(v), nil
 	case uint32:
-		return int64(v)
+		return int64(v), nil
 	case uint64:
-		log.Debug().Err(errors.New("ToInt64: lossy conversion from uint64"), "")
-		return int64(v)
+		if v > math.MaxInt64 {
+			return int64(v), newConversionError(i, int64Type, ConversionOverflow)
+		}
+		return int64(v), nil
 	case float32:
-		return int64(v)
+		n, reason := float64ToInt64(float64(v))
+		if reason != 0 {
+			return n, newConversionError(i, int64Type, reason)
+		}
+		return n, nil
 	case float64:
-		return int64(v)
+		n, reason := float64ToInt64(v)
+		if reason != 0 {
+			return n, newConversionError(i, int64Type, reason)
+		}
+		return n, nil
 	case string:
-		val, err := stringToInt64(v)
-		if err != nil {
-			log.Warn().Err(errors.Errorf("ToInt64: string '%s' is not a number", v), "")
-			return 0
+		n, reason := stringToInt64(v)
+		if reason != 0 {
+			return n, newConversionError(i, int64Type, reason)
 		}
-		return val
+		return n, nil
 	case bool:
 		if v {
-			return 1
+			return 1, nil
 		}
-		return 0
-	default:
-		log.Warn().Err(errors.Errorf("ToInt64: type %T not implemented", i), "")
+		return 0, nil
 	}
-	return 0
+	return 0, newConversionError(i, int64Type, ConversionUnsupportedType)
 }
 
 // ToUInt64 converts a number to an uint64 value.
 func ToUInt64(i interface{}) uint64 {
+	n, err := ToUInt64E(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return n
+}
+
+// ToUInt64E is like ToUInt64, but returns a *ConversionError when the conversion fails
+// or loses information. The returned value is the same as ToUInt64 returns.
+func ToUInt64E(i interface{}) (uint64, error) {
 	switch v := i.(type) {
 	case nil:
-		return 0
+		return 0, nil
 	case int:
-		return uint64(v)
+		return int64ToUint64(i, int64(v))
 	case int8:
-		return uint64(v)
+		return int64ToUint64(i, int64(v))
 	case int16:
-		return uint64(v)
+		return int64ToUint64(i, int64(v))
 	case int32:
-		return uint64(v)
+		return int64ToUint64(i, int64(v))
 	case int64:
-		return uint64(v)
+		return int64ToUint64(i, v)
 	case uint8:
-		return uint64(v)
+		return uint64(v), nil
 	case uint16:
-		return uint64(v)
+		return uint64(v), nil
 	case uint32:
-		return uint64(v)
+		return uint64(v), nil
 	case uint64:
-		return v
+		return v, nil
 	case float32:
-		return uint64(v)
+		n, reason := float64ToUint64(float64(v))
+		if reason != 0 {
+			return n, newConversionError(i, uint64Type, reason)
+		}
+		return n, nil
 	case float64:
-		return uint64(v)
+		n, reason := float64ToUint64(v)
+		if reason != 0 {
+			return n, newConversionError(i, uint64Type, reason)
+		}
+		return n, nil
 	case bool:
 		if v {
-			return 1
+			return 1, nil
 		}
-		return 0
+		return 0, nil
 	case string:
-		val, err := stringToUInt64(v)
-		if err != nil {
-			log.Warn().Err(errors.Errorf("ToInt64: string '%s' is not a number", v), "")
-			return 0
+		n, reason := stringToUInt64(v)
+		if reason != 0 {
+			return n, newConversionError(i, uint64Type, reason)
 		}
-		return val
-	default:
-		log.Warn().Err(errors.Errorf("ToUInt64: type %T not implemented", i), "")
+		return n, nil
 	}
-	return 0
+	return 0, newConversionError(i, uint64Type, ConversionUnsupportedType)
+}
+
+func int64ToUint64(i interface{}, n int64) (uint64, error) {
+	if n < 0 {
+		return uint64(n), newConversionError(i, uint64Type, ConversionOverflow)
+	}
+	return uint64(n), nil
 }
 
 // ToFloat64 converts a number to float64 value.
 func ToFloat64(i interface{}) float64 {
+	f, err := ToFloat64E(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return f
+}
+
+// ToFloat64E is like ToFloat64, but returns a *ConversionError when the conversion fails
+// or loses information. The returned value is the same as ToFloat64 returns.
+func ToFloat64E(i interface{}) (float64, error) {
 	switch v := i.(type) {
 	case nil:
-		return 0
+		return 0, nil
 	case int:
-		return float64(v)
+		return int64ToFloat64(i, int64(v))
 	case int8:
-		return float64(v)
+		return float64(v), nil
 	case int16:
-		return float64(v)
+		return float64(v), nil
 	case int32:
-		return float64(v)
+		return float64(v), nil
 	case int64:
-		return float64(v)
+		return int64ToFloat64(i, v)
 	case uint8:
-		return float64(v)
+		return float64(v), nil
 	case uint16:
-		return float64(v)
+		return float64(v), nil
 	case uint32:
-		return float64(v)
+		return float64(v), nil
 	case uint64:
-		return float64(v)
+		f := float64(v)
+		if f >= 1<<64 || uint64(f) != v {
+			return f, newConversionError(i, float64Type, ConversionPrecisionLoss)
+		}
+		return f, nil
 	case float32:
-		return float64(v)
+		return float64(v), nil
 	case float64:
-		return v
+		return v, nil
 	case string:
 		if v == "" {
-			return 0
+			return 0, nil
 		}
 		val, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Warn().Err(errors.Errorf("ToFloat64: string '%s' is not a number", v), "")
-			return 0
+			if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+				return val, newConversionError(i, float64Type, ConversionOverflow)
+			}
+			return 0, newConversionError(i, float64Type, ConversionInvalidSyntax)
 		}
-		return val
+		return val, nil
 	case bool:
 		if v {
-			return 1
+			return 1, nil
 		}
-		return 0
-	default:
-		log.Warn().Err(errors.Errorf("ToFloat64: type %T not implemented", i), "")
+		return 0, nil
 	}
-	return 0
+	return 0, newConversionError(i, float64Type, ConversionUnsupportedType)
+}
+
+func int64ToFloat64(i interface{}, n int64) (float64, error) {
+	f := float64(n)
+	if f >= 1<<63 || int64(f) != n {
+		return f, newConversionError(i, float64Type, ConversionPrecisionLoss)
+	}
+	return f, nil
 }
 
 // ToString converts a value to string.
 func ToString(i interface{}) string {
+	s, err := ToStringE(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return s
+}
+
+// ToStringE is like ToString, but returns a *ConversionError when the value
+// can't be converted.
+func ToStringE(i interface{}) (string, error) {
 	switch v := i.(type) {
 	case nil:
-		return ""
+		return "", nil
 	case int:
-		return strconv.Itoa(v)
+		return strconv.Itoa(v), nil
 	case int8:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), nil
 	case int16:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), nil
 	case int32:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), nil
 	case int64:
-		return strconv.FormatInt(v, 10)
+		return strconv.FormatInt(v, 10), nil
 	case uint8:
-		return strconv.FormatUint(uint64(v), 10)
+		return strconv.FormatUint(uint64(v), 10), nil
 	case uint16:
-		return strconv.FormatUint(uint64(v), 10)
+		return strconv.FormatUint(uint64(v), 10), nil
 	case uint32:
-		return strconv.FormatUint(uint64(v), 10)
+		return strconv.FormatUint(uint64(v), 10), nil
 	case uint64:
-		return strconv.FormatUint(v, 10)
+		return strconv.FormatUint(v, 10), nil
 	case float32:
-		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
 	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
 	case string:
-		return v
+		return v, nil
 	case bool:
 		if v {
-			return "true"
+			return "true", nil
 		}
-		return "false"
-	default:
-		log.Warn().Err(errors.Errorf("ToString: type %T not implemented", i), "")
+		return "false", nil
 	}
-	return ""
+	return "", newConversionError(i, stringType, ConversionUnsupportedType)
 }
 
 // ToBool converts a value to bool.
 func ToBool(i interface{}) bool {
+	b, err := ToBoolE(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return b
+}
+
+// ToBoolE is like ToBool, but returns a *ConversionError when the value
+// is neither a boolean nor 0 or 1.
+func ToBoolE(i interface{}) (bool, error) {
 	switch v := i.(type) {
 	case nil:
-		return false
-	case int:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from int (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case int8:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from int8 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case int16:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from int16 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case int32:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from int32 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case int64:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from int64 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case uint8:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from uint8 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case uint16:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from uint16 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case uint32:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from uint32 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case uint64:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from uint64 (%d)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case float32:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from float32 (%f)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
-	case float64:
-		log.Debug().Err(errors.Errorf("ToBool: lossy conversion from float64 (%f)", v), "")
-		if v == 1 {
-			return true
-		}
-		return false
+		return false, nil
+	case bool:
+		return v, nil
 	case string:
 		b, err := strconv.ParseBool(v)
 		if err != nil {
-			log.Warn().Err(errors.Errorf("ToBool: string '%s' is not a boolean", v), "")
+			return b, newConversionError(i, boolType, ConversionInvalidSyntax)
 		}
-		return b
-	case bool:
-		return v
-	default:
-		log.Warn().Err(errors.Errorf("ToBool: type %T not implemented", i), "")
+		return b, nil
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64:
+		f, _ := ToFloat64E(v)
+		if f != 0 && f != 1 {
+			return false, newConversionError(i, boolType, ConversionOverflow)
+		}
+		return f == 1, nil
 	}
-	return false
+	return false, newConversionError(i, boolType, ConversionUnsupportedType)
 }
 
 // ToTime converts a value to time.Time.
 func ToTime(i interface{}) time.Time {
+	t, err := ToTimeE(i)
+	if err != nil {
+		logConversionError(err)
+	}
+	return t
+}
+
+// ToTimeE is like ToTime, but returns a *ConversionError when the value
+// can't be converted.
+func ToTimeE(i interface{}) (time.Time, error) {
 	switch v := i.(type) {
 	case nil:
-		return time.Time{}
+		return time.Time{}, nil
 	case float64:
-		return time.Unix(0, int64(v*millisec))
+		return time.Unix(0, int64(v*millisec)), nil
 	case uint32:
-		return time.Unix(int64(v), 0)
+		return time.Unix(int64(v), 0), nil
 	case int64:
-		return time.Unix(v/1000, (v%1000)*millisec)
+		return time.Unix(v/1000, (v%1000)*millisec), nil
 	case string:
 		t, err := stringToTime(v)
 		if err != nil {
-			log.Warn().Err(err, "ToTime: invalid string value or not unimplemented layout",
-				log.String("value", v))
+			convErr := newConversionError(i, timeType, ConversionInvalidSyntax)
+			convErr.Err = err
+			return t, convErr
 		}
-		return t
+		return t, nil
 	case time.Time:
-		return v
+		return v, nil
 	case *time.Time:
-		return *v
-	default:
-		log.Warn().Err(errors.Errorf("ToTime: type %T not implemented", i), "")
+		return *v, nil
 	}
-	return time.Time{}
+	return time.Time{}, newConversionError(i, timeType, ConversionUnsupportedType)
 }
 
 func stringToTime(s string) (time.Time, error) {
@@ -359,38 +445,58 @@ func stringToTime(s string) (time.Time, error) {
 	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
 }
 
-func stringToInt64(s string) (int64, error) {
+func float64ToInt64(f float64) (int64, ConversionReason) {
+	n := int64(f)
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return n, ConversionOverflow
+	}
+	if float64(n) != f {
+		return n, ConversionPrecisionLoss
+	}
+	return n, 0
+}
+
+func float64ToUint64(f float64) (uint64, ConversionReason) {
+	n := uint64(f)
+	if math.IsNaN(f) || f < 0 || f >= math.MaxUint64 {
+		return n, ConversionOverflow
+	}
+	if float64(n) != f {
+		return n, ConversionPrecisionLoss
+	}
+	return n, 0
+}
+
+func stringToInt64(s string) (int64, ConversionReason) {
 	if s == "" {
-		return 0, nil
+		return 0, 0
 	}
 	val, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
-		return val, nil
+		return val, 0
 	}
 
 	// try if it is a float
 	val2, r := strconv.ParseFloat(s, 64)
 	if r != nil {
-		// return original error, not float parsing error
-		return 0, err
+		return 0, ConversionInvalidSyntax
 	}
-	return int64(val2), nil
+	return float64ToInt64(val2)
 }
 
-func stringToUInt64(s string) (uint64, error) {
+func stringToUInt64(s string) (uint64, ConversionReason) {
 	if s == "" {
-		return 0, nil
+		return 0, 0
 	}
 	val, err := strconv.ParseUint(s, 10, 64)
 	if err == nil {
-		return val, nil
+		return val, 0
 	}
 
 	// try if it is a float
 	val2, r := strconv.ParseFloat(s, 64)
 	if r != nil {
-		// return original error, not float parsing error
-		return 0, err
+		return 0, ConversionInvalidSyntax
 	}
-	return uint64(val2), nil
+	return float64ToUint64(val2)
 }
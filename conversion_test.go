@@ -1,7 +1,10 @@
 package msgpack
 
 import (
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -237,3 +240,105 @@ func TestConversion_ToNumbers(t *testing.T) {
 		})
 	}
 }
+
+func TestConversion_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		conv   func() (interface{}, error)
+		want   interface{}
+		reason ConversionReason
+	}{
+		{
+			name:   "uint64 overflows int64",
+			conv:   func() (interface{}, error) { return ToInt64E(uint64(1 << 63)) },
+			want:   int64(-1 << 63),
+			reason: ConversionOverflow,
+		},
+		{
+			name:   "fraction is lost",
+			conv:   func() (interface{}, error) { return ToInt64E(1.5) },
+			want:   int64(1),
+			reason: ConversionPrecisionLoss,
+		},
+		{
+			name:   "non-numeric string",
+			conv:   func() (interface{}, error) { return ToInt64E("abc") },
+			want:   int64(0),
+			reason: ConversionInvalidSyntax,
+		},
+		{
+			name:   "negative to unsigned",
+			conv:   func() (interface{}, error) { return ToUInt64E(int8(-1)) },
+			want:   uint64(1<<64 - 1),
+			reason: ConversionOverflow,
+		},
+		{
+			name:   "NaN to unsigned",
+			conv:   func() (interface{}, error) { return ToUInt64E(math.NaN()) },
+			reason: ConversionOverflow,
+		},
+		{
+			name:   "large int64 to float64",
+			conv:   func() (interface{}, error) { return ToFloat64E(int64(1<<53 + 1)) },
+			want:   float64(1 << 53),
+			reason: ConversionPrecisionLoss,
+		},
+		{
+			name:   "unsupported type",
+			conv:   func() (interface{}, error) { return ToStringE([]int{1}) },
+			want:   "",
+			reason: ConversionUnsupportedType,
+		},
+		{
+			name:   "int is not 0 or 1",
+			conv:   func() (interface{}, error) { return ToBoolE(2) },
+			want:   false,
+			reason: ConversionOverflow,
+		},
+		{
+			name:   "string is not a boolean",
+			conv:   func() (interface{}, error) { return ToBoolE("yes") },
+			want:   false,
+			reason: ConversionInvalidSyntax,
+		},
+		{
+			name:   "unknown time layout",
+			conv:   func() (interface{}, error) { return ToTimeE("yesterday") },
+			reason: ConversionInvalidSyntax,
+		},
+		{
+			name: "exact conversion",
+			conv: func() (interface{}, error) { return ToInt64E("42") },
+			want: int64(42),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asrt := is.New(t)
+
+			got, err := tt.conv()
+			if tt.want != nil {
+				asrt.Equal(tt.want, got)
+			}
+			if tt.reason == 0 {
+				asrt.NoErr(err)
+				return
+			}
+
+			convErr, ok := err.(*ConversionError)
+			asrt.True(ok)
+			asrt.Equal(tt.reason, convErr.Reason)
+		})
+	}
+
+	t.Run("time parse error is kept", func(t *testing.T) {
+		asrt := is.New(t)
+
+		_, err := ToTimeE("yesterday")
+		convErr, ok := err.(*ConversionError)
+		asrt.True(ok)
+		_, ok = convErr.Err.(*time.ParseError)
+		asrt.True(ok)
+		asrt.True(strings.Contains(err.Error(), `cannot parse "yesterday"`))
+	})
+}
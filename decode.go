@@ -3,6 +3,7 @@ package msgpack
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"reflect"
 	"sync"
@@ -15,6 +16,10 @@ import (
 const (
 	looseInterfaceDecodingFlag uint32 = 1 << iota
 	disallowUnknownFieldsFlag
+	strictTypesFlag
+	rawExtFlag
+	internedStringsFlag
+	zeroCopyFlag
 )
 
 const (
@@ -43,6 +48,7 @@ func GetDecoder() *Decoder {
 func PutDecoder(dec *Decoder) {
 	dec.r = nil
 	dec.s = nil
+	dec.data = nil
 	decPool.Put(dec)
 }
 
@@ -53,7 +59,7 @@ func PutDecoder(dec *Decoder) {
 func Unmarshal(data []byte, v interface{}) error {
 	dec := GetDecoder()
 
-	dec.Reset(bytes.NewReader(data))
+	dec.ResetBytes(data)
 	err := dec.Decode(v)
 
 	PutDecoder(dec)
@@ -69,10 +75,24 @@ type Decoder struct {
 
 	rec []byte // accumulates read data if not nil
 
+	data      []byte // input set by ResetBytes
+	fromBytes bool
+
+	offset int64 // number of bytes read
+	code   byte  // last code read
+	depth  int   // nesting depth of the value being decoded
+
 	dict       []string
 	flags      uint32
 	structTag  string
 	mapDecoder func(*Decoder) (interface{}, error)
+	timeDecFn  func(*Decoder) (time.Time, error)
+
+	overflowPolicy OverflowPolicy
+	timeOptions    TimeOptions
+	limits         Limits
+
+	extRegistry *ExtRegistry
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -95,9 +115,26 @@ func (d *Decoder) Reset(r io.Reader) {
 // ResetDict is like Reset, but also resets the dict.
 func (d *Decoder) ResetDict(r io.Reader, dict []string) {
 	d.resetReader(r)
+	d.resetOptions(dict)
+}
+
+// ResetBytes is like Reset, but switches the decoder to read from data.
+// Reading from a byte slice is faster than reading from an io.Reader,
+// because the decoder reads the slice directly instead of copying it.
+func (d *Decoder) ResetBytes(data []byte) {
+	d.resetBytes(data)
+	d.resetOptions(nil)
+}
+
+func (d *Decoder) resetOptions(dict []string) {
 	d.flags = 0
 	d.structTag = ""
 	d.mapDecoder = nil
+	d.timeDecFn = nil
+	d.overflowPolicy = OverflowTruncate
+	d.timeOptions = TimeOptions{}
+	d.limits = Limits{}
+	d.extRegistry = nil
 	d.dict = dict
 }
 
@@ -110,6 +147,11 @@ func (d *Decoder) WithDict(dict []string, fn func(*Decoder) error) error {
 }
 
 func (d *Decoder) resetReader(r io.Reader) {
+	d.offset = 0
+	d.code = 0
+	d.depth = 0
+	d.data = nil
+	d.fromBytes = false
 	if br, ok := r.(bufReader); ok {
 		d.r = br
 		d.s = br
@@ -120,10 +162,66 @@ func (d *Decoder) resetReader(r io.Reader) {
 	}
 }
 
+func (d *Decoder) resetBytes(data []byte) {
+	d.offset = 0
+	d.code = 0
+	d.depth = 0
+	d.r = nil
+	d.s = nil
+	d.data = data
+	d.fromBytes = true
+}
+
 func (d *Decoder) SetMapDecoder(fn func(*Decoder) (interface{}, error)) {
 	d.mapDecoder = fn
 }
 
+// SetTimeDecoder sets the function used to decode time.Time values,
+// including struct fields, slice elements and map values.
+// The function may call DecodeTime for the default behaviour.
+func (d *Decoder) SetTimeDecoder(fn func(*Decoder) (time.Time, error)) {
+	d.timeDecFn = fn
+}
+
+// SetOverflowPolicy sets what the decoder does when a number does not fit
+// into the integer type it is decoded into, e.g. 300 into uint8.
+// The default is OverflowTruncate.
+func (d *Decoder) SetOverflowPolicy(policy OverflowPolicy) {
+	d.overflowPolicy = policy
+}
+
+// SetTimeOptions controls how time.Time values are decoded.
+func (d *Decoder) SetTimeOptions(opts TimeOptions) {
+	d.timeOptions = opts
+}
+
+// UseRawExt causes the Decoder to decode unknown extensions into interface{}
+// as *RawExt instead of returning an error.
+func (d *Decoder) UseRawExt(on bool) {
+	if on {
+		d.flags |= rawExtFlag
+	} else {
+		d.flags &= ^rawExtFlag
+	}
+}
+
+// SetExtRegistry causes the Decoder to look up extension types in r
+// before the global registry.
+func (d *Decoder) SetExtRegistry(r *ExtRegistry) {
+	d.extRegistry = r
+}
+
+// UseZeroCopy causes a Decoder reset with ResetBytes to return strings and
+// byte slices that share memory with the input instead of copying them.
+// The input must not be modified while the decoded values are in use.
+func (d *Decoder) UseZeroCopy(on bool) {
+	if on {
+		d.flags |= zeroCopyFlag
+	} else {
+		d.flags &= ^zeroCopyFlag
+	}
+}
+
 // UseLooseInterfaceDecoding causes decoder to use DecodeInterfaceLoose
 // to decode msgpack value into Go interface{}.
 func (d *Decoder) UseLooseInterfaceDecoding(on bool) {
@@ -151,18 +249,32 @@ func (d *Decoder) DisallowUnknownFields(on bool) {
 	}
 }
 
+// UseStrictTypes causes the Decoder to return a *TypeMismatchError instead of
+// converting values of a different type, e.g. decoding msgpack string into Go int.
+// Nil is still decoded as a zero value.
+func (d *Decoder) UseStrictTypes(on bool) {
+	if on {
+		d.flags |= strictTypesFlag
+	} else {
+		d.flags &= ^strictTypesFlag
+	}
+}
+
 // UseInternedStrings enables support for decoding interned strings.
 func (d *Decoder) UseInternedStrings(on bool) {
 	if on {
-		d.flags |= useInternedStringsFlag
+		d.flags |= internedStringsFlag
 	} else {
-		d.flags &= ^useInternedStringsFlag
+		d.flags &= ^internedStringsFlag
 	}
 }
 
 // Buffered returns a reader of the data remaining in the Decoder's buffer.
 // The reader is valid until the next call to Decode.
 func (d *Decoder) Buffered() io.Reader {
+	if d.fromBytes {
+		return bytes.NewReader(d.data[d.offset:])
+	}
 	return d.r
 }
 
@@ -256,11 +368,6 @@ func (d *Decoder) Decode(v interface{}) error {
 			*v = time.Duration(vv)
 			return err
 		}
-	case *time.Time:
-		if v != nil {
-			*v, err = d.DecodeTime()
-			return err
-		}
 	}
 
 	vv := reflect.ValueOf(v)
@@ -304,10 +411,21 @@ func (d *Decoder) decodeInterfaceCond() (interface{}, error) {
 }
 
 func (d *Decoder) DecodeValue(v reflect.Value) error {
-	decode := getDecoder(v.Type())
+	decode := d.getDecoder(v.Type())
 	return decode(d, v)
 }
 
+// getDecoder returns the decoder for typ, preferring the Decoder's ext
+// registry over the global one.
+func (d *Decoder) getDecoder(typ reflect.Type) decoderFunc {
+	if d.extRegistry != nil {
+		if fn, ok := d.extRegistry.decoder(typ); ok {
+			return fn
+		}
+	}
+	return getDecoder(typ)
+}
+
 func (d *Decoder) DecodeNil() error {
 	c, err := d.readCode()
 	if err != nil {
@@ -338,11 +456,19 @@ func (d *Decoder) DecodeBool() (bool, error) {
 	}
 
 	if !msgpcode.IsBool(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return false, &TypeMismatchError{Kind: reflect.Bool, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return false, err
 		}
-		return ToBool(val), nil
+		b, err := ToBoolE(val)
+		if err != nil {
+			logConversionError(err)
+			return b, nil
+		}
+		return b, nil
 	}
 
 	return d.bool(c)
@@ -397,7 +523,7 @@ func (d *Decoder) decodeInterfaceFromCode(c byte) (interface{}, error) {
 		return int8(c), nil
 	}
 	if msgpcode.IsFixedMap(c) {
-		err := d.s.UnreadByte()
+		err := d.unreadByte()
 		if err != nil {
 			return nil, err
 		}
@@ -442,7 +568,7 @@ func (d *Decoder) decodeInterfaceFromCode(c byte) (interface{}, error) {
 	case msgpcode.Array16, msgpcode.Array32:
 		return d.decodeSlice(c)
 	case msgpcode.Map16, msgpcode.Map32:
-		err := d.s.UnreadByte()
+		err := d.unreadByte()
 		if err != nil {
 			return nil, err
 		}
@@ -470,7 +596,7 @@ func (d *Decoder) DecodeInterfaceLoose() (interface{}, error) {
 		return int64(int8(c)), nil
 	}
 	if msgpcode.IsFixedMap(c) {
-		err = d.s.UnreadByte()
+		err = d.unreadByte()
 		if err != nil {
 			return nil, err
 		}
@@ -500,7 +626,7 @@ func (d *Decoder) DecodeInterfaceLoose() (interface{}, error) {
 	case msgpcode.Array16, msgpcode.Array32:
 		return d.decodeSlice(c)
 	case msgpcode.Map16, msgpcode.Map32:
-		err = d.s.UnreadByte()
+		err = d.unreadByte()
 		if err != nil {
 			return nil, err
 		}
@@ -560,7 +686,28 @@ func (d *Decoder) Skip() error {
 	return errors.Errorf("msgpack: unknown code %x", c)
 }
 
+// SkipUnknownField skips the value of the struct field name that has no
+// destination field. If DisallowUnknownFields is set, it returns an error
+// instead. It is meant for CustomDecoder implementations of structs.
+func (d *Decoder) SkipUnknownField(name string) error {
+	if d.flags&disallowUnknownFieldsFlag != 0 {
+		return d.fieldError(errors.Errorf("msgpack: unknown field %q", name), string([]byte(name)))
+	}
+	if err := d.Skip(); err != nil {
+		return d.fieldError(err, string([]byte(name)))
+	}
+	return nil
+}
+
 func (d *Decoder) DecodeRaw() (RawMessage, error) {
+	if d.fromBytes && d.rec == nil {
+		start := d.offset
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return RawMessage(d.copyBytes(d.data[start:d.offset])), nil
+	}
+
 	d.rec = make([]byte, 0)
 	if err := d.Skip(); err != nil {
 		return nil, err
@@ -573,6 +720,12 @@ func (d *Decoder) DecodeRaw() (RawMessage, error) {
 // PeekCode returns the next MessagePack code without advancing the reader.
 // Subpackage msgpack/codes defines the list of available msgpcode.
 func (d *Decoder) PeekCode() (byte, error) {
+	if d.fromBytes {
+		if d.offset >= int64(len(d.data)) {
+			return 0, io.EOF
+		}
+		return d.data[d.offset], nil
+	}
 	c, err := d.s.ReadByte()
 	if err != nil {
 		return 0, err
@@ -582,28 +735,88 @@ func (d *Decoder) PeekCode() (byte, error) {
 
 // ReadFull reads exactly len(buf) bytes into the buf.
 func (d *Decoder) ReadFull(buf []byte) error {
-	_, err := readN(d.r, buf, len(buf))
+	if d.fromBytes {
+		_, err := d.readBytes(buf[:0], len(buf), false)
+		return err
+	}
+	n, err := io.ReadFull(d.r, buf)
+	d.offset += int64(n)
 	return err
 }
 
+// InputOffset returns the number of bytes the decoder has read so far.
+func (d *Decoder) InputOffset() int64 {
+	return d.offset
+}
+
 func (d *Decoder) hasNilCode() bool {
 	code, err := d.PeekCode()
 	return err == nil && code == msgpcode.Nil
 }
 
 func (d *Decoder) readCode() (byte, error) {
+	if err := d.checkRead(1); err != nil {
+		return 0, err
+	}
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	d.code = c
+	return c, nil
+}
+
+// readByte reads a byte of payload, e.g. a length or an ext id.
+func (d *Decoder) readByte() (byte, error) {
+	if d.fromBytes {
+		if d.offset >= int64(len(d.data)) {
+			return 0, io.EOF
+		}
+		c := d.data[d.offset]
+		d.offset++
+		if d.rec != nil {
+			d.rec = append(d.rec, c)
+		}
+		return c, nil
+	}
+
 	c, err := d.s.ReadByte()
 	if err != nil {
 		return 0, err
 	}
+	d.offset++
 	if d.rec != nil {
 		d.rec = append(d.rec, c)
 	}
 	return c, nil
 }
 
+// unreadByte unreads the byte returned by the last readCode.
+func (d *Decoder) unreadByte() error {
+	if d.fromBytes {
+		if d.offset == 0 {
+			return errors.New("msgpack: unreadByte at beginning of input")
+		}
+	} else if err := d.s.UnreadByte(); err != nil {
+		return err
+	}
+	d.offset--
+	if d.rec != nil {
+		d.rec = d.rec[:len(d.rec)-1]
+	}
+	return nil
+}
+
 func (d *Decoder) readFull(b []byte) error {
-	_, err := io.ReadFull(d.r, b)
+	if err := d.checkRead(len(b)); err != nil {
+		return err
+	}
+	if d.fromBytes {
+		_, err := d.readBytes(b[:0], len(b), false)
+		return err
+	}
+	n, err := io.ReadFull(d.r, b)
+	d.offset += int64(n)
 	if err != nil {
 		return err
 	}
@@ -614,11 +827,18 @@ func (d *Decoder) readFull(b []byte) error {
 }
 
 func (d *Decoder) readN(n int) ([]byte, error) {
+	if err := d.checkRead(n); err != nil {
+		return nil, err
+	}
+	if d.fromBytes {
+		return d.readBytes(nil, n, true)
+	}
 	var err error
 	d.buf, err = readN(d.r, d.buf, n)
 	if err != nil {
 		return nil, err
 	}
+	d.offset += int64(n)
 	if d.rec != nil {
 		// TODO: read directly into d.rec?
 		d.rec = append(d.rec, d.buf...)
@@ -626,6 +846,39 @@ func (d *Decoder) readN(n int) ([]byte, error) {
 	return d.buf, nil
 }
 
+// readBytes reads n bytes from the input set by ResetBytes. It appends
+// them to b unless alias is set, in which case it returns a slice of the input.
+func (d *Decoder) readBytes(b []byte, n int, alias bool) ([]byte, error) {
+	avail := int64(len(d.data)) - d.offset
+	if int64(n) > avail {
+		d.offset = int64(len(d.data))
+		if avail == 0 && n > 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	src := d.data[d.offset : d.offset+int64(n)]
+	d.offset += int64(n)
+	if d.rec != nil {
+		d.rec = append(d.rec, src...)
+	}
+	if alias {
+		return src, nil
+	}
+	return append(b, src...), nil
+}
+
+// copyBytes returns a copy of b, or b itself when zero copy is enabled.
+func (d *Decoder) copyBytes(b []byte) []byte {
+	if d.flags&zeroCopyFlag != 0 {
+		return b
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
 func readN(r io.Reader, b []byte, n int) ([]byte, error) {
 	if b == nil {
 		if n == 0 {
@@ -673,3 +926,31 @@ func min(a, b int) int { //nolint:unparam
 	}
 	return b
 }
+
+// fieldError adds the struct field or map key name to the path of err.
+func (d *Decoder) fieldError(err error, name string) error {
+	return d.pathError(err, name)
+}
+
+// indexError adds the array index or non-string map key i to the path of err.
+func (d *Decoder) indexError(err error, i interface{}) error {
+	return d.pathError(err, fmt.Sprintf("[%v]", i))
+}
+
+func (d *Decoder) pathError(err error, segment string) error {
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		return &DecodeError{
+			Path:   segment,
+			Offset: d.offset,
+			Code:   d.code,
+			Err:    err,
+		}
+	}
+	if decErr.Path == "" || decErr.Path[0] == '[' {
+		decErr.Path = segment + decErr.Path
+	} else {
+		decErr.Path = segment + "." + decErr.Path
+	}
+	return decErr
+}
@@ -0,0 +1,317 @@
+package msgpack
+
+import (
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+var errIterNoValue = errors.New("msgpack: iterator is not positioned on an element")
+
+// ArrayIter iterates over the elements of an array without decoding the
+// whole array into memory. It is created with Decoder.ArrayIter:
+//
+//	it := dec.ArrayIter()
+//	for it.Next() {
+//		var item Item
+//		if err := it.Decode(&item); err != nil {
+//			return err
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+//
+// An element that is neither decoded nor skipped is skipped by the next
+// call to Next. Nested arrays and maps must be iterated with the ArrayIter
+// and MapIter methods of the iterator, not of the Decoder. The Decoder must
+// not be used directly until Next returns false.
+type ArrayIter struct {
+	iter
+}
+
+// MapIter iterates over the entries of a map. It is used like ArrayIter,
+// except that Key returns the key of the current entry and Decode, Skip,
+// ArrayIter and MapIter operate on its value.
+type MapIter struct {
+	iter
+}
+
+// ArrayIter returns an iterator over the array at the current position.
+// A nil array is iterated as an empty one.
+func (d *Decoder) ArrayIter() *ArrayIter {
+	it := &ArrayIter{iter{d: d}}
+	it.open()
+	return it
+}
+
+// MapIter returns an iterator over the map at the current position.
+// A nil map is iterated as an empty one.
+func (d *Decoder) MapIter() *MapIter {
+	it := &MapIter{iter{d: d, isMap: true}}
+	it.open()
+	return it
+}
+
+// ChunkedArrayIter is like ArrayIter, but iterates over an array written
+// with chunked framing by Encoder.BeginArray.
+func (d *Decoder) ChunkedArrayIter() *ArrayIter {
+	it := &ArrayIter{iter{d: d, chunked: true}}
+	it.open()
+	return it
+}
+
+// ChunkedMapIter is like MapIter, but iterates over a map written with
+// chunked framing by Encoder.BeginMap.
+func (d *Decoder) ChunkedMapIter() *MapIter {
+	it := &MapIter{iter{d: d, isMap: true, chunked: true}}
+	it.open()
+	return it
+}
+
+// Next advances the iterator to the next element and reports whether
+// there is one. It returns false at the end of the array or on error.
+func (it *ArrayIter) Next() bool {
+	return it.next(false)
+}
+
+// Next advances the iterator to the next entry, decoding its key, and
+// reports whether there is one. It returns false at the end of the map or
+// on error.
+func (it *MapIter) Next() bool {
+	return it.next(true)
+}
+
+// Key returns the key of the current entry.
+func (it *MapIter) Key() interface{} {
+	return it.key
+}
+
+type iter struct {
+	d       *Decoder
+	isMap   bool
+	chunked bool
+
+	len   int // total number of elements or -1 when chunked
+	left  int // elements left in the current chunk
+	total int // elements in the chunks read so far
+
+	key     interface{}
+	ready   bool  // the current value was not consumed yet
+	child   *iter // iterator over the current value
+	entered bool  // the container counts in the nesting depth
+	done    bool
+	err     error
+}
+
+// open starts iterating over the container at the current position.
+func (it *iter) open() {
+	if err := it.d.enter(); err != nil {
+		it.fail(err)
+		return
+	}
+	it.entered = true
+
+	if it.chunked {
+		it.len = -1
+		return
+	}
+
+	var n int
+	var err error
+	if it.isMap {
+		n, err = it.d.DecodeMapLen()
+	} else {
+		n, err = it.d.DecodeArrayLen()
+	}
+	if err != nil {
+		it.fail(err)
+		return
+	}
+	if n < 0 {
+		n = 0
+	}
+	it.len = n
+	it.left = n
+}
+
+func (it *iter) end() {
+	it.done = true
+	it.ready = false
+	if it.entered {
+		it.entered = false
+		it.d.leave()
+	}
+}
+
+func (it *iter) fail(err error) {
+	it.err = err
+	it.end()
+}
+
+// Len returns the number of elements, or -1 for chunked containers.
+func (it *iter) Len() int {
+	return it.len
+}
+
+// Err returns the first error encountered by the iterator.
+func (it *iter) Err() error {
+	return it.err
+}
+
+func (it *iter) next(decodeKey bool) bool {
+	if it.done {
+		return false
+	}
+	if err := it.finishValue(); err != nil {
+		it.fail(err)
+		return false
+	}
+
+	for it.left == 0 {
+		if !it.chunked {
+			it.end()
+			return false
+		}
+
+		n, err := it.nextChunk()
+		if err != nil {
+			it.fail(err)
+			return false
+		}
+		if n <= 0 {
+			it.end()
+			return false
+		}
+		it.left = n
+	}
+	it.left--
+
+	if it.isMap {
+		var err error
+		if decodeKey {
+			it.key, err = it.d.DecodeInterface()
+		} else {
+			err = it.d.Skip()
+		}
+		if err != nil {
+			it.fail(err)
+			return false
+		}
+	}
+
+	it.ready = true
+	return true
+}
+
+// nextChunk reads the length of the next chunk. The limits on the
+// length apply to all chunks together.
+func (it *iter) nextChunk() (int, error) {
+	if it.isMap {
+		n, err := it.d.DecodeMapLen()
+		if err != nil || n <= 0 {
+			return n, err
+		}
+		it.total += n
+		return n, it.d.checkMapLen(it.total)
+	}
+
+	n, err := it.d.DecodeArrayLen()
+	if err != nil || n <= 0 {
+		return n, err
+	}
+	it.total += n
+	return n, it.d.checkArrayLen(it.total)
+}
+
+// finishValue skips the rest of the current value.
+func (it *iter) finishValue() error {
+	if it.child != nil {
+		child := it.child
+		it.child = nil
+		for child.next(false) {
+		}
+		return child.err
+	}
+	if it.ready {
+		it.ready = false
+		return it.d.Skip()
+	}
+	return nil
+}
+
+func (it *iter) value() error {
+	if !it.ready {
+		if it.err != nil {
+			return it.err
+		}
+		return errIterNoValue
+	}
+	it.ready = false
+	return nil
+}
+
+// Decode decodes the current value into v.
+func (it *iter) Decode(v interface{}) error {
+	if err := it.value(); err != nil {
+		return err
+	}
+	if err := it.d.Decode(v); err != nil {
+		it.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Skip skips the current value.
+func (it *iter) Skip() error {
+	if err := it.value(); err != nil {
+		return err
+	}
+	if err := it.d.Skip(); err != nil {
+		it.fail(err)
+		return err
+	}
+	return nil
+}
+
+// ArrayIter returns an iterator over the current value, which must be an array.
+func (it *iter) ArrayIter() *ArrayIter {
+	child := &ArrayIter{iter{d: it.d}}
+	it.openChild(&child.iter)
+	return child
+}
+
+// MapIter returns an iterator over the current value, which must be a map.
+func (it *iter) MapIter() *MapIter {
+	child := &MapIter{iter{d: it.d, isMap: true}}
+	it.openChild(&child.iter)
+	return child
+}
+
+// ChunkedArrayIter returns an iterator over the current value, which must
+// be an array written with chunked framing.
+func (it *iter) ChunkedArrayIter() *ArrayIter {
+	child := &ArrayIter{iter{d: it.d, chunked: true}}
+	it.openChild(&child.iter)
+	return child
+}
+
+// ChunkedMapIter returns an iterator over the current value, which must be
+// a map written with chunked framing.
+func (it *iter) ChunkedMapIter() *MapIter {
+	child := &MapIter{iter{d: it.d, isMap: true, chunked: true}}
+	it.openChild(&child.iter)
+	return child
+}
+
+func (it *iter) openChild(child *iter) {
+	if err := it.value(); err != nil {
+		child.fail(err)
+		return
+	}
+	child.open()
+	if child.err != nil {
+		it.fail(child.err)
+		return
+	}
+	it.child = child
+}
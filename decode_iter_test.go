@@ -0,0 +1,146 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIter(t *testing.T) {
+	type item struct {
+		ID   int
+		Tags []string
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	require.Nil(t, enc.Encode(map[string]interface{}{
+		"items": []interface{}{
+			item{ID: 1, Tags: []string{"a"}},
+			item{ID: 2},
+			[]int{1, 2, 3},
+			map[string]interface{}{"x": []int{4, 5}, "y": 6},
+			item{ID: 3},
+		},
+	}))
+	require.Nil(t, enc.Encode("after"))
+
+	dec := msgpack.NewDecoder(&buf)
+	m := dec.MapIter()
+	require.Equal(t, 1, m.Len())
+	require.True(t, m.Next())
+	require.Equal(t, "items", m.Key())
+
+	it := m.ArrayIter()
+	require.Equal(t, 5, it.Len())
+
+	var ids []int
+	var nested []int
+	for i := 0; it.Next(); i++ {
+		switch i {
+		case 0, 4:
+			var v item
+			require.Nil(t, it.Decode(&v))
+			ids = append(ids, v.ID)
+		case 1:
+			// Left unconsumed.
+		case 2:
+			ints := it.ArrayIter()
+			require.True(t, ints.Next())
+			var n int
+			require.Nil(t, ints.Decode(&n))
+			nested = append(nested, n)
+			// The rest of the array is skipped.
+		case 3:
+			entries := it.MapIter()
+			for entries.Next() {
+				if entries.Key() == "x" {
+					xs := entries.ArrayIter()
+					for xs.Next() {
+						var n int
+						require.Nil(t, xs.Decode(&n))
+						nested = append(nested, n)
+					}
+					require.Nil(t, xs.Err())
+				}
+			}
+			require.Nil(t, entries.Err())
+		}
+	}
+	require.Nil(t, it.Err())
+	require.False(t, m.Next())
+	require.Nil(t, m.Err())
+
+	require.Equal(t, []int{1, 3}, ids)
+	require.Equal(t, []int{1, 4, 5}, nested)
+
+	s, err := dec.DecodeString()
+	require.Nil(t, err)
+	require.Equal(t, "after", s)
+}
+
+func TestIterChunked(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(writeOnly{&buf})
+	require.Nil(t, enc.BeginArray())
+	for i := 0; i < 10000; i++ {
+		require.Nil(t, enc.Append(i))
+	}
+	require.Nil(t, enc.BeginArray())
+	require.Nil(t, enc.Append("nested"))
+	require.Nil(t, enc.End())
+	require.Nil(t, enc.End())
+
+	it := msgpack.NewDecoder(&buf).ChunkedArrayIter()
+	require.Equal(t, -1, it.Len())
+	for i := 0; i < 10000; i++ {
+		require.True(t, it.Next())
+		var n int
+		require.Nil(t, it.Decode(&n))
+		require.Equal(t, i, n)
+	}
+
+	// Nested containers are written with their length.
+	require.True(t, it.Next())
+	nested := it.ArrayIter()
+	require.Equal(t, 1, nested.Len())
+	require.True(t, nested.Next())
+	var s string
+	require.Nil(t, nested.Decode(&s))
+	require.Equal(t, "nested", s)
+
+	require.False(t, it.Next())
+	require.Nil(t, it.Err())
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestIterErrors(t *testing.T) {
+	b, err := msgpack.Marshal([]int{1, 2, 3})
+	require.Nil(t, err)
+
+	it := msgpack.NewDecoder(bytes.NewReader(b)).ArrayIter()
+	var n int
+	require.NotNil(t, it.Decode(&n))
+	require.True(t, it.Next())
+	require.Nil(t, it.Decode(&n))
+	require.NotNil(t, it.Decode(&n))
+
+	it = msgpack.NewDecoder(bytes.NewReader(b[:len(b)-1])).ArrayIter()
+	for it.Next() {
+	}
+	require.NotNil(t, it.Err())
+
+	b, err = msgpack.Marshal("not an array")
+	require.Nil(t, err)
+	it = msgpack.NewDecoder(bytes.NewReader(b)).ArrayIter()
+	require.False(t, it.Next())
+	require.NotNil(t, it.Err())
+
+	b, err = msgpack.Marshal([]int(nil))
+	require.Nil(t, err)
+	it = msgpack.NewDecoder(bytes.NewReader(b)).ArrayIter()
+	require.False(t, it.Next())
+	require.Nil(t, it.Err())
+}
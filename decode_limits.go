@@ -0,0 +1,119 @@
+package msgpack
+
+import (
+	"fmt"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// ErrLimitExceeded is wrapped by the *LimitError returned by a Decoder
+// when the input exceeds one of its Limits.
+var ErrLimitExceeded = errors.New("msgpack: limit exceeded")
+
+// Limits restricts the resources a Decoder may use, so that hostile input
+// can't exhaust memory or the stack. A zero field means no limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of arrays, maps and structs.
+	MaxDepth int
+	// MaxStringLen is the maximum length of a string in bytes.
+	MaxStringLen int
+	// MaxBinLen is the maximum length of binary and extension data in bytes.
+	MaxBinLen int
+	// MaxArrayLen is the maximum number of array elements. The elements
+	// of all chunks of a chunked array count together.
+	MaxArrayLen int
+	// MaxMapLen is the maximum number of map entries, counted like
+	// MaxArrayLen.
+	MaxMapLen int
+	// MaxTotalBytes is the maximum number of bytes read since the last Reset.
+	MaxTotalBytes int64
+}
+
+// LimitError is returned by a Decoder when the input exceeds one of its Limits.
+type LimitError struct {
+	Limit string // name of the Limits field, e.g. "MaxDepth"
+	Value int64  // value found in the input
+	Max   int64  // configured limit
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("msgpack: %s exceeded (%d > %d)", err.Limit, err.Value, err.Max)
+}
+
+func (err *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// SetLimits sets the limits enforced while decoding. Reset removes them.
+func (d *Decoder) SetLimits(limits Limits) {
+	d.limits = limits
+}
+
+// Limits returns the limits set with SetLimits.
+func (d *Decoder) Limits() Limits {
+	return d.limits
+}
+
+func limitExceeded(limit string, value int64, max int64) error {
+	return &LimitError{
+		Limit: limit,
+		Value: value,
+		Max:   max,
+	}
+}
+
+// enter is called before decoding the elements of a container. Every call
+// that returns nil must be followed by a call to leave.
+func (d *Decoder) enter() error {
+	d.depth++
+	if max := d.limits.MaxDepth; max > 0 && d.depth > max {
+		d.depth--
+		return limitExceeded("MaxDepth", int64(d.depth+1), int64(max))
+	}
+	return nil
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+// checkRead reports whether n more bytes may be read.
+func (d *Decoder) checkRead(n int) error {
+	if max := d.limits.MaxTotalBytes; max > 0 && d.offset+int64(n) > max {
+		return limitExceeded("MaxTotalBytes", d.offset+int64(n), max)
+	}
+	return nil
+}
+
+func (d *Decoder) checkBytesLen(c byte, n int) error {
+	limit, max := "MaxStringLen", d.limits.MaxStringLen
+	if msgpcode.IsBin(c) {
+		limit, max = "MaxBinLen", d.limits.MaxBinLen
+	}
+	if max > 0 && n > max {
+		return limitExceeded(limit, int64(n), int64(max))
+	}
+	return d.checkRead(n)
+}
+
+func (d *Decoder) checkExtLen(n int) error {
+	if max := d.limits.MaxBinLen; max > 0 && n > max {
+		return limitExceeded("MaxBinLen", int64(n), int64(max))
+	}
+	return d.checkRead(n)
+}
+
+func (d *Decoder) checkArrayLen(n int) error {
+	if max := d.limits.MaxArrayLen; max > 0 && n > max {
+		return limitExceeded("MaxArrayLen", int64(n), int64(max))
+	}
+	return nil
+}
+
+func (d *Decoder) checkMapLen(n int) error {
+	if max := d.limits.MaxMapLen; max > 0 && n > max {
+		return limitExceeded("MaxMapLen", int64(n), int64(max))
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"github.com/stretchr/testify/require"
+)
+
+func requireLimitError(t *testing.T, err error, limit string) {
+	if decErr, ok := err.(*msgpack.DecodeError); ok {
+		err = decErr.Err
+	}
+	limitErr, ok := err.(*msgpack.LimitError)
+	require.True(t, ok, "got %v", err)
+	require.Equal(t, limit, limitErr.Limit)
+	require.Equal(t, msgpack.ErrLimitExceeded, limitErr.Unwrap())
+}
+
+func TestLimits(t *testing.T) {
+	nested := bytes.Repeat([]byte{msgpcode.FixedArrayLow | 1}, 100000)
+	nested = append(nested, msgpcode.Nil)
+
+	str32 := []byte{msgpcode.Str32, 0xff, 0xff, 0xff, 0xff}
+
+	mustMarshal := func(v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		require.Nil(t, err)
+		return b
+	}
+
+	type node struct {
+		Children []node
+	}
+	deepNode := node{}
+	for i := 0; i < 20; i++ {
+		deepNode = node{Children: []node{deepNode}}
+	}
+
+	tests := []struct {
+		limits msgpack.Limits
+		b      []byte
+		v      interface{}
+		limit  string
+	}{
+		{msgpack.Limits{MaxDepth: 100}, nested, new(interface{}), "MaxDepth"},
+		{msgpack.Limits{MaxDepth: 100}, nested, nil, "MaxDepth"},
+		{msgpack.Limits{MaxDepth: 10}, mustMarshal(deepNode), new(node), "MaxDepth"},
+		{msgpack.Limits{MaxDepth: 1}, mustMarshal(map[string]interface{}{"a": []int{1}}), new(map[string]interface{}), "MaxDepth"},
+		{msgpack.Limits{MaxStringLen: 3}, mustMarshal("hello"), new(string), "MaxStringLen"},
+		{msgpack.Limits{MaxStringLen: 3}, mustMarshal([]string{"hello"}), new(interface{}), "MaxStringLen"},
+		{msgpack.Limits{MaxBinLen: 3}, mustMarshal([]byte("hello")), new([]byte), "MaxBinLen"},
+		{msgpack.Limits{MaxBinLen: 3}, mustMarshal(&msgpack.RawExt{Type: 1, Data: []byte("hello")}), nil, "MaxBinLen"},
+		{msgpack.Limits{MaxArrayLen: 2}, mustMarshal([]int{1, 2, 3}), new([]int), "MaxArrayLen"},
+		{msgpack.Limits{MaxArrayLen: 2}, mustMarshal([]int{1, 2, 3}), nil, "MaxArrayLen"},
+		{msgpack.Limits{MaxMapLen: 1}, mustMarshal(map[string]int{"a": 1, "b": 2}), new(map[string]int), "MaxMapLen"},
+		{msgpack.Limits{MaxMapLen: 1}, mustMarshal(map[string]int{"a": 1, "b": 2}), new(interface{}), "MaxMapLen"},
+		{msgpack.Limits{MaxTotalBytes: 1 << 20}, str32, new(string), "MaxTotalBytes"},
+		{msgpack.Limits{MaxTotalBytes: 4}, mustMarshal([]int{1, 2, 3, 4, 5}), new([]int), "MaxTotalBytes"},
+	}
+	for i, test := range tests {
+		for _, fromBytes := range []bool{false, true} {
+			dec := msgpack.NewDecoder(bytes.NewReader(test.b))
+			if fromBytes {
+				dec.ResetBytes(test.b)
+			}
+			dec.SetLimits(test.limits)
+			require.Equal(t, test.limits, dec.Limits())
+
+			var err error
+			if test.v == nil {
+				err = dec.Skip()
+			} else {
+				err = dec.Decode(test.v)
+			}
+			require.NotNil(t, err, "#%d", i)
+			requireLimitError(t, err, test.limit)
+		}
+	}
+
+	// Values within the limits are decoded.
+	dec := msgpack.NewDecoder(nil)
+	dec.ResetBytes(mustMarshal(map[string]interface{}{"a": []interface{}{"abc", 1}}))
+	dec.SetLimits(msgpack.Limits{
+		MaxDepth:      2,
+		MaxStringLen:  3,
+		MaxArrayLen:   2,
+		MaxMapLen:     1,
+		MaxTotalBytes: 100,
+	})
+	v, err := dec.DecodeInterface()
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{"a": []interface{}{"abc", int8(1)}}, v)
+
+	// Reset removes the limits.
+	dec.Reset(strings.NewReader(string(nested)))
+	require.Equal(t, msgpack.Limits{}, dec.Limits())
+	require.Nil(t, dec.Skip())
+}
+
+func TestLimitsQuery(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}},
+	})
+	require.Nil(t, err)
+
+	newDecoder := func(limits msgpack.Limits) *msgpack.Decoder {
+		dec := msgpack.NewDecoder(nil)
+		dec.ResetBytes(b)
+		dec.SetLimits(limits)
+		return dec
+	}
+
+	for _, query := range []string{"a.b.c", "a.*.c", "..c", "a[?c].c"} {
+		_, err := newDecoder(msgpack.Limits{MaxDepth: 2}).Query(query)
+		requireLimitError(t, err, "MaxDepth")
+
+		var n int
+		_, err = newDecoder(msgpack.Limits{MaxDepth: 2}).QueryOne(query, &n)
+		requireLimitError(t, err, "MaxDepth")
+
+		values, err := newDecoder(msgpack.Limits{MaxDepth: 3}).Query(query)
+		require.Nil(t, err, query)
+		require.Equal(t, []interface{}{int8(1)}, values, query)
+	}
+
+	_, err = newDecoder(msgpack.Limits{MaxDepth: 2}).Extract(map[string]string{"c": "a.b.c"})
+	requireLimitError(t, err, "MaxDepth")
+
+	_, err = newDecoder(msgpack.Limits{MaxMapLen: 1}).Query("a.b.c")
+	require.Nil(t, err)
+
+	arr, err := msgpack.Marshal([]int{1, 2, 3})
+	require.Nil(t, err)
+	for _, query := range []string{"2", "[-1]"} {
+		dec := msgpack.NewDecoder(nil)
+		dec.ResetBytes(arr)
+		dec.SetLimits(msgpack.Limits{MaxArrayLen: 2})
+		_, err = dec.Query(query)
+		requireLimitError(t, err, "MaxArrayLen")
+	}
+
+	// The depth of the containers around the value does not outlive the query.
+	dec := newDecoder(msgpack.Limits{MaxDepth: 3})
+	dec.ResetBytes(append(append([]byte{}, b...), b...))
+	values, err := dec.Query("a.b.c")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{int8(1)}, values)
+	var v interface{}
+	require.Nil(t, dec.Decode(&v))
+}
+
+func TestLimitsIter(t *testing.T) {
+	nested, err := msgpack.Marshal([][]int{{1}, {2}})
+	require.Nil(t, err)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(nested))
+	dec.SetLimits(msgpack.Limits{MaxDepth: 1})
+	it := dec.ArrayIter()
+	require.True(t, it.Next())
+	child := it.ArrayIter()
+	require.False(t, child.Next())
+	requireLimitError(t, child.Err(), "MaxDepth")
+	require.False(t, it.Next())
+	requireLimitError(t, it.Err(), "MaxDepth")
+
+	dec = msgpack.NewDecoder(bytes.NewReader(nested))
+	dec.SetLimits(msgpack.Limits{MaxDepth: 1})
+	require.Nil(t, dec.ArrayIter().Err())
+	dec = msgpack.NewDecoder(bytes.NewReader(nested))
+	dec.SetLimits(msgpack.Limits{MaxDepth: 1})
+	dec.ArrayIter().Next()
+	var v interface{}
+	err = dec.Decode(&v)
+	requireLimitError(t, err, "MaxDepth")
+
+	// The depth is restored when the iteration ends.
+	dec = msgpack.NewDecoder(bytes.NewReader(append(append([]byte{}, nested...), nested...)))
+	dec.SetLimits(msgpack.Limits{MaxDepth: 2})
+	it = dec.ArrayIter()
+	for it.Next() {
+		child := it.ArrayIter()
+		for child.Next() {
+		}
+		require.Nil(t, child.Err())
+	}
+	require.Nil(t, it.Err())
+	require.Nil(t, dec.Decode(&v))
+
+	// The length limits apply to all chunks of a chunked container together.
+	chunkedArray := []byte{
+		msgpcode.FixedArrayLow | 2, 1, 2,
+		msgpcode.FixedArrayLow | 1, 3,
+		msgpcode.FixedArrayLow,
+	}
+	chunkedMap := []byte{
+		msgpcode.FixedMapLow | 1, msgpcode.FixedStrLow | 1, 'a', 1,
+		msgpcode.FixedMapLow | 1, msgpcode.FixedStrLow | 1, 'b', 2,
+		msgpcode.FixedMapLow,
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(chunkedArray))
+	dec.SetLimits(msgpack.Limits{MaxArrayLen: 2})
+	it = dec.ChunkedArrayIter()
+	for it.Next() {
+		require.Nil(t, it.Skip())
+	}
+	requireLimitError(t, it.Err(), "MaxArrayLen")
+
+	dec = msgpack.NewDecoder(bytes.NewReader(chunkedMap))
+	dec.SetLimits(msgpack.Limits{MaxMapLen: 1})
+	mit := dec.ChunkedMapIter()
+	for mit.Next() {
+		require.Nil(t, mit.Skip())
+	}
+	requireLimitError(t, mit.Err(), "MaxMapLen")
+
+	dec = msgpack.NewDecoder(bytes.NewReader(chunkedArray))
+	dec.SetLimits(msgpack.Limits{MaxArrayLen: 2})
+	var ints []int
+	requireLimitError(t, dec.DecodeChunked(&ints), "MaxArrayLen")
+
+	dec = msgpack.NewDecoder(bytes.NewReader(chunkedMap))
+	dec.SetLimits(msgpack.Limits{MaxMapLen: 1})
+	var m map[string]int
+	requireLimitError(t, dec.DecodeChunked(&m), "MaxMapLen")
+
+	dec = msgpack.NewDecoder(bytes.NewReader(chunkedArray))
+	dec.SetLimits(msgpack.Limits{MaxArrayLen: 3, MaxDepth: 1})
+	ints = nil
+	require.Nil(t, dec.DecodeChunked(&ints))
+	require.Equal(t, []int{1, 2, 3}, ints)
+}
@@ -22,6 +22,11 @@ var (
 )
 
 func decodeMapValue(d *Decoder, v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	n, err := d.DecodeMapLen()
 	if err != nil {
 		return err
@@ -44,6 +49,11 @@ func decodeMapValue(d *Decoder, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeMapDefault() (interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
 	if d.mapDecoder != nil {
 		return d.mapDecoder(d)
 	}
@@ -83,15 +93,22 @@ func (d *Decoder) mapLen(c byte) (int, error) {
 		return -1, nil
 	}
 	if c >= msgpcode.FixedMapLow && c <= msgpcode.FixedMapHigh {
-		return int(c & msgpcode.FixedMapMask), nil
+		size := int(c & msgpcode.FixedMapMask)
+		return size, d.checkMapLen(size)
 	}
 	if c == msgpcode.Map16 {
 		size, err := d.uint16()
-		return int(size), err
+		if err != nil {
+			return 0, err
+		}
+		return int(size), d.checkMapLen(int(size))
 	}
 	if c == msgpcode.Map32 {
 		size, err := d.uint32()
-		return int(size), err
+		if err != nil {
+			return 0, err
+		}
+		return int(size), d.checkMapLen(int(size))
 	}
 	return 0, unexpectedCodeError{code: c, hint: "map length"}
 }
@@ -102,6 +119,11 @@ func decodeMapStringStringValue(d *Decoder, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeMapStringStringPtr(ptr *map[string]string) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	size, err := d.DecodeMapLen()
 	if err != nil {
 		return err
@@ -124,7 +146,7 @@ func (d *Decoder) decodeMapStringStringPtr(ptr *map[string]string) error {
 		}
 		mv, err := d.DecodeString()
 		if err != nil {
-			return err
+			return d.fieldError(err, mk)
 		}
 		m[mk] = mv
 	}
@@ -138,6 +160,11 @@ func decodeMapStringInterfaceValue(d *Decoder, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeMapStringInterfacePtr(ptr *map[string]interface{}) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	m, err := d.DecodeMap()
 	if err != nil {
 		return err
@@ -153,6 +180,9 @@ func (d *Decoder) DecodeMap() (map[string]interface{}, error) {
 	}
 
 	if !msgpcode.IsMap(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return nil, &TypeMismatchError{Kind: reflect.Map, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return nil, err
@@ -180,7 +210,7 @@ func (d *Decoder) DecodeMap() (map[string]interface{}, error) {
 		}
 		mv, err := d.decodeInterfaceCond()
 		if err != nil {
-			return nil, err
+			return nil, d.fieldError(err, mk)
 		}
 		m[mk] = mv
 	}
@@ -208,7 +238,7 @@ func (d *Decoder) DecodeUntypedMap() (map[interface{}]interface{}, error) {
 
 		mv, err := d.decodeInterfaceCond()
 		if err != nil {
-			return nil, err
+			return nil, d.indexError(err, mk)
 		}
 
 		m[mk] = mv
@@ -270,7 +300,10 @@ func (d *Decoder) decodeTypedMapValue(v reflect.Value, n int) error {
 
 		mv := reflect.New(valueType).Elem()
 		if err := d.DecodeValue(mv); err != nil {
-			return err
+			if mk.Kind() == reflect.String {
+				return d.fieldError(err, mk.String())
+			}
+			return d.indexError(err, mk.Interface())
 		}
 
 		v.SetMapIndex(mk, mv)
@@ -280,6 +313,11 @@ func (d *Decoder) decodeTypedMapValue(v reflect.Value, n int) error {
 }
 
 func (d *Decoder) skipMap(c byte) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	n, err := d.mapLen(c)
 	if err != nil {
 		return err
@@ -296,6 +334,11 @@ func (d *Decoder) skipMap(c byte) error {
 }
 
 func decodeStructValue(d *Decoder, v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	c, err := d.readCode()
 	if err != nil {
 		return err
@@ -324,7 +367,7 @@ func decodeStructValue(d *Decoder, v reflect.Value) error {
 
 	for _, f := range fields.List {
 		if err := f.DecodeValue(d, v); err != nil {
-			return err
+			return d.fieldError(err, f.name)
 		}
 	}
 
@@ -346,15 +389,12 @@ func (d *Decoder) decodeStruct(v reflect.Value, n int) error {
 
 		if f := fields.Map[name]; f != nil {
 			if err := f.DecodeValue(d, v); err != nil {
-				return err
+				return d.fieldError(err, f.name)
 			}
 			continue
 		}
 
-		if d.flags&disallowUnknownFieldsFlag != 0 {
-			return errors.Errorf("msgpack: unknown field %q", name)
-		}
-		if err := d.Skip(); err != nil {
+		if err := d.SkipUnknownField(name); err != nil {
 			return err
 		}
 	}
@@ -14,7 +14,7 @@ func (d *Decoder) skipN(n int) error {
 }
 
 func (d *Decoder) uint8() (uint8, error) {
-	c, err := d.readCode()
+	c, err := d.readByte()
 	if err != nil {
 		return 0, err
 	}
@@ -77,23 +77,79 @@ func (d *Decoder) int64() (int64, error) {
 	return int64(n), err
 }
 
+// OverflowPolicy controls what the decoder does when a number does not fit
+// into the integer type it is decoded into.
+type OverflowPolicy int
+
+const (
+	// OverflowTruncate keeps the low-order bits, like a Go conversion does.
+	// It is the default.
+	OverflowTruncate OverflowPolicy = iota
+	// OverflowSaturate clamps the number to the closest value the type can hold.
+	OverflowSaturate
+	// OverflowError makes the decoder return a *ConversionError. Mismatched
+	// values that lose precision, e.g. 1.5 decoded into an int, are rejected too.
+	OverflowError
+)
+
+var (
+	int8Type   = reflect.TypeOf(int8(0))
+	int16Type  = reflect.TypeOf(int16(0))
+	int32Type  = reflect.TypeOf(int32(0))
+	uintType   = reflect.TypeOf(uint(0))
+	uint8Type  = reflect.TypeOf(uint8(0))
+	uint16Type = reflect.TypeOf(uint16(0))
+	uint32Type = reflect.TypeOf(uint32(0))
+)
+
 // DecodeUint64 decodes msgpack int8/16/32/64 and uint8/16/32/64
 // into Go uint64.
 func (d *Decoder) DecodeUint64() (uint64, error) {
+	return d.decodeUint(uint64Type)
+}
+
+// decodeUint decodes an unsigned integer and applies the overflow policy
+// for the size of typ.
+func (d *Decoder) decodeUint(typ reflect.Type) (uint64, error) {
 	c, err := d.readCode()
 	if err != nil {
 		return 0, err
 	}
 
 	if !msgpcode.IsInt(c) && !msgpcode.IsUInt(c) && !msgpcode.IsFixedNum(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return 0, &TypeMismatchError{Kind: typ.Kind(), Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return 0, err
 		}
-		return ToUInt64(val), nil
+		n, err := ToUInt64E(val)
+		if err != nil {
+			n, err = d.uintConversionFailed(n, err)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return d.narrowUint(n, typ)
 	}
 
-	return d.uint(c)
+	if isSignedCode(c) {
+		n, err := d.int(c)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 {
+			return d.uintOverflow(n, uint64(n), typ)
+		}
+		return d.narrowUint(uint64(n), typ)
+	}
+
+	n, err := d.uint(c)
+	if err != nil {
+		return 0, err
+	}
+	return d.narrowUint(n, typ)
 }
 
 func (d *Decoder) uint(c byte) (uint64, error) {
@@ -131,20 +187,51 @@ func (d *Decoder) uint(c byte) (uint64, error) {
 // DecodeInt64 decodes msgpack int8/16/32/64 and uint8/16/32/64
 // into Go int64.
 func (d *Decoder) DecodeInt64() (int64, error) {
+	return d.decodeInt(int64Type)
+}
+
+// decodeInt decodes a signed integer and applies the overflow policy
+// for the size of typ.
+func (d *Decoder) decodeInt(typ reflect.Type) (int64, error) {
 	c, err := d.readCode()
 	if err != nil {
 		return 0, err
 	}
 
 	if !msgpcode.IsInt(c) && !msgpcode.IsUInt(c) && !msgpcode.IsFixedNum(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return 0, &TypeMismatchError{Kind: typ.Kind(), Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return 0, err
 		}
-		return ToInt64(val), nil
+		n, err := ToInt64E(val)
+		if err != nil {
+			n, err = d.intConversionFailed(n, err)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return d.narrowInt(n, typ)
+	}
+
+	if c == msgpcode.Uint64 {
+		n, err := d.uint64()
+		if err != nil {
+			return 0, err
+		}
+		if n > math.MaxInt64 {
+			return d.intOverflow(n, int64(n), typ)
+		}
+		return d.narrowInt(int64(n), typ)
 	}
 
-	return d.int(c)
+	n, err := d.int(c)
+	if err != nil {
+		return 0, err
+	}
+	return d.narrowInt(n, typ)
 }
 
 func (d *Decoder) int(c byte) (int64, error) {
@@ -187,11 +274,19 @@ func (d *Decoder) DecodeFloat32() (float32, error) {
 	}
 
 	if c != msgpcode.Float {
+		if d.flags&strictTypesFlag != 0 && !isNumberCode(c) {
+			return 0, &TypeMismatchError{Kind: reflect.Float32, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return 0, err
 		}
-		return float32(ToFloat64(val)), nil
+		f, err := ToFloat64E(val)
+		if err != nil {
+			logConversionError(err)
+			return float32(f), nil
+		}
+		return float32(f), nil
 	}
 
 	return d.float32(c)
@@ -221,11 +316,19 @@ func (d *Decoder) DecodeFloat64() (float64, error) {
 	}
 
 	if !msgpcode.IsFloat(c) {
+		if d.flags&strictTypesFlag != 0 && !isNumberCode(c) {
+			return 0, &TypeMismatchError{Kind: reflect.Float64, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return 0, err
 		}
-		return ToFloat64(val), nil
+		f, err := ToFloat64E(val)
+		if err != nil {
+			logConversionError(err)
+			return f, nil
+		}
+		return f, nil
 	}
 
 	return d.float64(c)
@@ -254,43 +357,141 @@ func (d *Decoder) float64(c byte) (float64, error) {
 	return float64(n), nil
 }
 
+// isNumberCode reports whether c is a msgpack int, uint, float, or nil code.
+func isNumberCode(c byte) bool {
+	return msgpcode.IsFixedNum(c) || msgpcode.IsInt(c) || msgpcode.IsUInt(c) ||
+		msgpcode.IsFloat(c) || c == msgpcode.Nil
+}
+
+// isSignedCode reports whether c is a msgpack int code or a negative fixnum.
+func isSignedCode(c byte) bool {
+	return msgpcode.IsInt(c) || msgpcode.IsFixedNum(c) && int8(c) < 0
+}
+
+// narrowInt applies the overflow policy if n does not fit into typ.
+func (d *Decoder) narrowInt(n int64, typ reflect.Type) (int64, error) {
+	if d.overflowPolicy == OverflowTruncate {
+		return n, nil
+	}
+	shift := uint(64 - typ.Bits())
+	if n<<shift>>shift == n {
+		return n, nil
+	}
+	return d.intOverflow(n, n, typ)
+}
+
+// narrowUint applies the overflow policy if n does not fit into typ.
+func (d *Decoder) narrowUint(n uint64, typ reflect.Type) (uint64, error) {
+	if d.overflowPolicy == OverflowTruncate || n>>uint(typ.Bits()) == 0 {
+		return n, nil
+	}
+	return d.uintOverflow(n, n, typ)
+}
+
+// intOverflow handles v that does not fit into the signed integer typ.
+// truncated is the value returned by OverflowTruncate.
+func (d *Decoder) intOverflow(v interface{}, truncated int64, typ reflect.Type) (int64, error) {
+	switch d.overflowPolicy {
+	case OverflowSaturate:
+		max := int64(math.MaxInt64 >> uint(64-typ.Bits()))
+		if isNegative(v) {
+			return -max - 1, nil
+		}
+		return max, nil
+	case OverflowError:
+		return 0, newConversionError(v, typ, ConversionOverflow)
+	}
+	return truncated, nil
+}
+
+// uintOverflow handles v that does not fit into the unsigned integer typ.
+// truncated is the value returned by OverflowTruncate.
+func (d *Decoder) uintOverflow(v interface{}, truncated uint64, typ reflect.Type) (uint64, error) {
+	switch d.overflowPolicy {
+	case OverflowSaturate:
+		if isNegative(v) {
+			return 0, nil
+		}
+		return math.MaxUint64 >> uint(64-typ.Bits()), nil
+	case OverflowError:
+		return 0, newConversionError(v, typ, ConversionOverflow)
+	}
+	return truncated, nil
+}
+
+// intConversionFailed handles err returned by ToInt64E for a mismatched value.
+func (d *Decoder) intConversionFailed(n int64, err error) (int64, error) {
+	convErr, ok := err.(*ConversionError)
+	if ok && convErr.Reason == ConversionOverflow && d.overflowPolicy == OverflowSaturate {
+		return d.intOverflow(convErr.Value, n, int64Type)
+	}
+	return n, d.numberConversionFailed(err)
+}
+
+// uintConversionFailed handles err returned by ToUInt64E for a mismatched value.
+func (d *Decoder) uintConversionFailed(n uint64, err error) (uint64, error) {
+	convErr, ok := err.(*ConversionError)
+	if ok && convErr.Reason == ConversionOverflow && d.overflowPolicy == OverflowSaturate {
+		return d.uintOverflow(convErr.Value, n, uint64Type)
+	}
+	return n, d.numberConversionFailed(err)
+}
+
+// numberConversionFailed is called when a number of a mismatched type could
+// not be converted exactly. Lossy conversion errors are returned when the
+// overflow policy is OverflowError; other errors are logged and decoding
+// continues with the converted value.
+func (d *Decoder) numberConversionFailed(err error) error {
+	if convErr, ok := err.(*ConversionError); ok && convErr.lossy() && d.overflowPolicy == OverflowError {
+		return err
+	}
+	logConversionError(err)
+	return nil
+}
+
+// isNegative reports whether the number v, possibly given as a string, is below zero.
+func isNegative(v interface{}) bool {
+	f, _ := ToFloat64E(v)
+	return f < 0
+}
+
 func (d *Decoder) DecodeUint() (uint, error) {
-	n, err := d.DecodeUint64()
+	n, err := d.decodeUint(uintType)
 	return uint(n), err
 }
 
 func (d *Decoder) DecodeUint8() (uint8, error) {
-	n, err := d.DecodeUint64()
+	n, err := d.decodeUint(uint8Type)
 	return uint8(n), err
 }
 
 func (d *Decoder) DecodeUint16() (uint16, error) {
-	n, err := d.DecodeUint64()
+	n, err := d.decodeUint(uint16Type)
 	return uint16(n), err
 }
 
 func (d *Decoder) DecodeUint32() (uint32, error) {
-	n, err := d.DecodeUint64()
+	n, err := d.decodeUint(uint32Type)
 	return uint32(n), err
 }
 
 func (d *Decoder) DecodeInt() (int, error) {
-	n, err := d.DecodeInt64()
+	n, err := d.decodeInt(intType)
 	return int(n), err
 }
 
 func (d *Decoder) DecodeInt8() (int8, error) {
-	n, err := d.DecodeInt64()
+	n, err := d.decodeInt(int8Type)
 	return int8(n), err
 }
 
 func (d *Decoder) DecodeInt16() (int16, error) {
-	n, err := d.DecodeInt64()
+	n, err := d.decodeInt(int16Type)
 	return int16(n), err
 }
 
 func (d *Decoder) DecodeInt32() (int32, error) {
-	n, err := d.DecodeInt64()
+	n, err := d.decodeInt(int32Type)
 	return int32(n), err
 }
 
@@ -313,7 +514,7 @@ func decodeFloat64Value(d *Decoder, v reflect.Value) error {
 }
 
 func decodeInt64Value(d *Decoder, v reflect.Value) error {
-	n, err := d.DecodeInt64()
+	n, err := d.decodeInt(v.Type())
 	if err != nil {
 		return err
 	}
@@ -322,7 +523,7 @@ func decodeInt64Value(d *Decoder, v reflect.Value) error {
 }
 
 func decodeUint64Value(d *Decoder, v reflect.Value) error {
-	n, err := d.DecodeUint64()
+	n, err := d.decodeUint(v.Type())
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,8 @@
 package msgpack
 
 import (
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -8,151 +10,1029 @@ import (
 	"gitlab.gostudent.cloud/pkg/log/errors"
 )
 
-type queryResult struct {
-	query       string
-	key         string
-	hasAsterisk bool
+// querySegment is a single step of a query path.
+type querySegment struct {
+	key     string // map key; also an array index when isIndex is set
+	index   int
+	isIndex bool
 
-	values []interface{}
+	wildcard bool // * matches every map value and array element
+
+	isSlice    bool // [start:end] matches a range of array elements
+	start, end int
+	hasStart   bool
+	hasEnd     bool
+
+	filter *queryFilter // [?path op value] matches elements the filter accepts
+
+	recursive bool // ..segment matches at any depth
 }
 
-func (q *queryResult) nextKey() {
-	ind := strings.IndexByte(q.query, '.')
-	if ind == -1 {
-		q.key = q.query
-		q.query = ""
-		return
-	}
-	q.key = q.query[:ind]
-	q.query = q.query[ind+1:]
+// queryFilter is a predicate like status=="active".
+type queryFilter struct {
+	path  []querySegment
+	op    string // empty when the filter only checks that the value is set
+	value interface{}
 }
 
+// Query is a compiled query. It is immutable and safe for concurrent use
+// by multiple goroutines.
+type Query struct {
+	src  string
+	segs []querySegment
+
+	// single is set when the query matches at most one value.
+	single bool
+	// plain is set when the query only consists of map keys and array
+	// indexes and can be evaluated by seekPlain.
+	plain bool
+}
+
+var errQueryDone = errors.New("msgpack: query done")
+
 // Query extracts data specified by the query from the msgpack stream skipping
 // any other data. Query consists of map keys and array indexes separated with dot,
-// e.g. key1.0.key2.
+// e.g. key1.0.key2. It also supports:
+//   - quoted keys: "key.with.dots" or ["key.with.dots"],
+//   - wildcards over map values and array elements: key1.*.key2 or key1[*],
+//   - negative indexes counted from the end of an array: key1[-1] or key1.-1,
+//   - array slices: key1[2:5], key1[:2] or key1[-2:],
+//   - recursive descent that matches at any depth: ..id or key1..id,
+//   - filters over map values and array elements: items[?status=="active"].id.
+//     Filters compare a value with a string, number, true, false or null using
+//     ==, !=, <, <=, > or >=. A filter without an operator, e.g. [?deleted],
+//     matches when the value is present and is not nil or false.
+//
+// Values are returned in the order they appear in the stream. Queries that can
+// match only one value stop reading as soon as it is found. A key that does
+// not apply to the value, e.g. a key of a string or a non-numeric key of an
+// array, matches nothing instead of returning an error.
 func (d *Decoder) Query(query string) ([]interface{}, error) {
-	res := queryResult{
-		query: query,
+	if isPlainQuery(query) {
+		return d.queryPlain(query)
+	}
+
+	q, err := CompileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return d.Run(q)
+}
+
+// Run is like Query, but evaluates a compiled query.
+func (d *Decoder) Run(q *Query) ([]interface{}, error) {
+	if q.plain {
+		return d.queryPlain(q.src)
 	}
-	if err := d.query(&res); err != nil {
+
+	values, err := d.RunMulti(q)
+	if err != nil {
 		return nil, err
 	}
-	return res.values, nil
+	return values[0], nil
 }
 
-func (d *Decoder) query(q *queryResult) error {
-	q.nextKey()
-	if q.key == "" {
+// RunMulti evaluates several compiled queries in a single pass over the next
+// value and returns the values matched by each query in the same order.
+func (d *Decoder) RunMulti(queries ...*Query) ([][]interface{}, error) {
+	values := make([][]interface{}, len(queries))
+	err := d.runQueries(queries, func(i int, d *Decoder) error {
 		v, err := d.decodeInterfaceCond()
 		if err != nil {
 			return err
 		}
-		q.values = append(q.values, v)
+		values[i] = append(values[i], v)
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return values, nil
+}
 
-	code, err := d.PeekCode()
+// Extract evaluates the queries in paths, keyed by an arbitrary name, in
+// a single pass over the next value and returns the matched values by name.
+// Names of queries that match nothing are omitted from the result.
+func (d *Decoder) Extract(paths map[string]string) (map[string][]interface{}, error) {
+	names := make([]string, 0, len(paths))
+	queries := make([]*Query, 0, len(paths))
+	for name, path := range paths {
+		q, err := CompileQuery(path)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		queries = append(queries, q)
+	}
+
+	values, err := d.RunMulti(queries...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	switch {
-	case code == msgpcode.Map16 || code == msgpcode.Map32 || msgpcode.IsFixedMap(code):
-		err = d.queryMapKey(q)
-	case code == msgpcode.Array16 || code == msgpcode.Array32 || msgpcode.IsFixedArray(code):
-		err = d.queryArrayIndex(q)
-	default:
-		err = errors.Errorf("msgpack: unsupported code=%x decoding key=%q", code, q.key)
+	m := make(map[string][]interface{}, len(names))
+	for i, name := range names {
+		if values[i] != nil {
+			m[name] = values[i]
+		}
 	}
-	return err
+	return m, nil
 }
 
-func (d *Decoder) queryMapKey(q *queryResult) error {
-	n, err := d.DecodeMapLen()
+// QueryInto is like Query, but decodes the matched values into dst
+// using the same rules as Decode. When the query can match several values,
+// e.g. it contains a wildcard, dst must be a pointer to a slice and each value
+// is decoded into a new element. dst is left unchanged when nothing matches.
+func (d *Decoder) QueryInto(query string, dst interface{}) error {
+	q, err := CompileQuery(query)
 	if err != nil {
 		return err
 	}
-	if n == -1 {
+	return d.RunInto(q, dst)
+}
+
+// RunInto is like QueryInto, but evaluates a compiled query.
+func (d *Decoder) RunInto(q *Query, dst interface{}) error {
+	if q.plain {
+		depth := d.depth
+		found, err := d.seekPlain(q.src)
+		if err == nil && found {
+			err = d.Decode(dst)
+		}
+		d.depth = depth
+		return err
+	}
+	if q.single {
+		return d.runQueries([]*Query{q}, func(_ int, d *Decoder) error {
+			return d.Decode(dst)
+		})
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("msgpack: QueryInto(%T) of query %q requires a pointer to a slice", dst, q.src)
+	}
+	v = v.Elem()
+
+	var matched bool
+	return d.runQueries([]*Query{q}, func(_ int, d *Decoder) error {
+		if !matched {
+			matched = true
+			v.Set(v.Slice(0, 0))
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := d.DecodeValue(elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem.Elem()))
 		return nil
+	})
+}
+
+// QueryOne decodes the first value matched by the query into dst and
+// reports whether there was a match.
+func (d *Decoder) QueryOne(query string, dst interface{}) (bool, error) {
+	q, err := CompileQuery(query)
+	if err != nil {
+		return false, err
 	}
+	return d.RunOne(q, dst)
+}
 
-	for i := 0; i < n; i++ {
-		key, err := d.decodeStringTemp()
-		if err != nil {
+// RunOne is like QueryOne, but evaluates a compiled query.
+func (d *Decoder) RunOne(q *Query, dst interface{}) (bool, error) {
+	if q.plain {
+		depth := d.depth
+		found, err := d.seekPlain(q.src)
+		if err == nil && found {
+			err = d.Decode(dst)
+		}
+		d.depth = depth
+		return found && err == nil, err
+	}
+
+	var found bool
+	err := d.runQueries([]*Query{q}, func(_ int, d *Decoder) error {
+		if err := d.Decode(dst); err != nil {
 			return err
 		}
+		found = true
+		return errQueryDone
+	})
+	return found, err
+}
 
-		if key == q.key {
-			if err := d.query(q); err != nil {
-				return err
-			}
-			if q.hasAsterisk {
-				return d.skipNext((n - i - 1) * 2)
+// ------------------------------------------------------------------------------
+
+// isPlainQuery reports whether the query only consists of map keys and
+// array indexes separated with dots, e.g. key1.0.key2.
+func isPlainQuery(query string) bool {
+	if query == "" || strings.ContainsAny(query, "[]") {
+		return false
+	}
+	start := true
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '.' {
+			if start {
+				return false
 			}
-			return nil
+			start = true
+			continue
+		}
+		if start && (c == '*' || c == '"' || c == '\'') {
+			return false
 		}
+		start = false
+	}
+	return !start
+}
 
-		if err := d.Skip(); err != nil {
-			return err
+// queryPlain evaluates a plain query. Unlike runQueries it does not
+// allocate to find the value.
+func (d *Decoder) queryPlain(query string) ([]interface{}, error) {
+	depth := d.depth
+	found, err := d.seekPlain(query)
+	var v interface{}
+	if err == nil && found {
+		v, err = d.decodeInterfaceCond()
+	}
+	d.depth = depth
+	if err != nil || !found {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+// seekPlain skips to the value matched by a plain query and reports whether
+// it was found. The rest of the containers around the value is left unread
+// and still counted in the nesting depth, which the caller restores.
+func (d *Decoder) seekPlain(query string) (bool, error) {
+	for query != "" {
+		key := query
+		query = ""
+		if i := strings.IndexByte(key, '.'); i != -1 {
+			key, query = key[:i], key[i+1:]
+		}
+
+		c, err := d.PeekCode()
+		if err != nil {
+			return false, err
+		}
+
+		var found bool
+		switch {
+		case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+			found, err = d.seekMapKey(key)
+		case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+			found, err = d.seekArrayIndex(key)
+		default:
+			// Scalars have no children to match.
+			err = d.Skip()
+		}
+		if err != nil || !found {
+			return false, err
 		}
 	}
+	return true, nil
+}
 
-	return nil
+func (d *Decoder) seekMapKey(key string) (bool, error) {
+	if err := d.enter(); err != nil {
+		return false, err
+	}
+
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < n; i++ {
+		k, err := d.queryKey()
+		if err != nil {
+			return false, err
+		}
+		if k == key {
+			return true, nil
+		}
+		if err := d.Skip(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
 }
 
-func (d *Decoder) queryArrayIndex(q *queryResult) error {
+func (d *Decoder) seekArrayIndex(key string) (bool, error) {
+	if err := d.enter(); err != nil {
+		return false, err
+	}
+
 	n, err := d.DecodeArrayLen()
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	index, ok := parsePlainIndex(key)
+	if ok {
+		index = resolveIndex(index, n)
+	}
+	for i := 0; i < n; i++ {
+		if ok && i == index {
+			return true, nil
+		}
+		if err := d.Skip(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// parsePlainIndex parses an array index. Keys that are not numbers are
+// rejected before strconv.Atoi, which allocates an error for them.
+func parsePlainIndex(key string) (int, bool) {
+	digits := key
+	if digits != "" && digits[0] == '-' {
+		digits = digits[1:]
 	}
-	if n == -1 {
+	if digits == "" {
+		return 0, false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(key)
+	return n, err == nil
+}
+
+// queryState is a position in one of the queries being evaluated.
+type queryState struct {
+	query int
+	pos   int
+}
+
+type queryRunner struct {
+	queries []*Query
+	visit   func(query int, d *Decoder) error
+
+	matched   []bool
+	remaining int // number of queries that are not matched yet
+	stopEarly bool
+}
+
+// runQueries evaluates queries in a single pass over the next value.
+// visit is called with a decoder positioned at each matched value
+// and must consume it.
+func (d *Decoder) runQueries(queries []*Query, visit func(query int, d *Decoder) error) error {
+	r := &queryRunner{
+		queries:   queries,
+		visit:     visit,
+		matched:   make([]bool, len(queries)),
+		remaining: len(queries),
+		stopEarly: true,
+	}
+
+	states := make([]queryState, len(queries))
+	for i, q := range queries {
+		states[i] = queryState{query: i}
+		if !q.single {
+			r.stopEarly = false
+		}
+	}
+
+	err := r.walk(d, states)
+	if err == errQueryDone {
 		return nil
 	}
+	return err
+}
 
-	if q.key == "*" {
-		q.hasAsterisk = true
+func (r *queryRunner) walk(d *Decoder, states []queryState) error {
+	var matches, next []queryState
+	for _, st := range states {
+		if st.pos == len(r.queries[st.query].segs) {
+			matches = append(matches, st)
+		} else {
+			next = append(next, st)
+		}
+	}
 
-		query := q.query
-		for i := 0; i < n; i++ {
-			q.query = query
-			if err := d.query(q); err != nil {
+	switch {
+	case len(matches) == 0 && len(next) == 0:
+		return d.Skip()
+	case len(matches) == 1 && len(next) == 0:
+		return r.emit(d, matches[0].query)
+	case len(matches) > 0:
+		// The value is needed more than once.
+		raw, err := d.DecodeRaw()
+		if err != nil {
+			return err
+		}
+		for _, st := range matches {
+			if err := r.emit(d.subDecoder(raw), st.query); err != nil {
 				return err
 			}
 		}
+		if len(next) == 0 {
+			return nil
+		}
+		return r.walkContainer(d.subDecoder(raw), next)
+	}
 
-		q.hasAsterisk = false
-		return nil
+	return r.walkContainer(d, next)
+}
+
+func (r *queryRunner) emit(d *Decoder, query int) error {
+	if err := r.visit(query, d); err != nil {
+		return err
+	}
+	if !r.matched[query] {
+		r.matched[query] = true
+		r.remaining--
+	}
+	if r.stopEarly && r.remaining == 0 {
+		return errQueryDone
 	}
+	return nil
+}
 
-	ind, err := strconv.Atoi(q.key)
+func (r *queryRunner) walkContainer(d *Decoder, states []queryState) error {
+	c, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		return r.walkMap(d, states)
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		return r.walkArray(d, states)
+	}
+	// Scalars have no children to match.
+	return d.Skip()
+}
+
+func (r *queryRunner) walkMap(d *Decoder, states []queryState) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	n, err := d.DecodeMapLen()
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < n; i++ {
-		if i == ind {
-			if err := d.query(q); err != nil {
-				return err
-			}
-			if q.hasAsterisk {
-				return d.skipNext(n - i - 1)
-			}
-			return nil
+		key, err := d.queryKey()
+		if err != nil {
+			return err
 		}
 
-		if err := d.Skip(); err != nil {
+		child, filters := r.advance(states, key, -1, 0)
+		if err := r.walkChild(d, child, filters); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-func (d *Decoder) skipNext(n int) error {
+func (r *queryRunner) walkArray(d *Decoder, states []queryState) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+
 	for i := 0; i < n; i++ {
-		if err := d.Skip(); err != nil {
+		child, filters := r.advance(states, "", i, n)
+		if err := r.walkChild(d, child, filters); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// advance returns the states of a child with the given map key or array index.
+// States that wait for a filter are returned separately, because filters
+// need the child value.
+func (r *queryRunner) advance(states []queryState, key string, index, n int) (child, filters []queryState) {
+	for _, st := range states {
+		seg := &r.queries[st.query].segs[st.pos]
+		if seg.recursive {
+			child = appendQueryState(child, st)
+		}
+		if seg.filter != nil {
+			filters = append(filters, st)
+			continue
+		}
+		if seg.match(key, index, n) {
+			child = appendQueryState(child, queryState{query: st.query, pos: st.pos + 1})
+		}
+	}
+	return child, filters
+}
+
+func (r *queryRunner) walkChild(d *Decoder, child, filters []queryState) error {
+	if len(filters) == 0 {
+		return r.walk(d, child)
+	}
+
+	raw, err := d.DecodeRaw()
+	if err != nil {
+		return err
+	}
+	v, err := d.subDecoder(raw).decodeInterfaceCond()
+	if err != nil {
+		return err
+	}
+
+	for _, st := range filters {
+		if r.queries[st.query].segs[st.pos].filter.match(v) {
+			child = appendQueryState(child, queryState{query: st.query, pos: st.pos + 1})
+		}
+	}
+	if len(child) == 0 {
+		return nil
+	}
+	return r.walk(d.subDecoder(raw), child)
+}
+
+func appendQueryState(states []queryState, st queryState) []queryState {
+	for _, s := range states {
+		if s == st {
+			return states
+		}
+	}
+	return append(states, st)
+}
+
+// queryKey decodes a map key as a string. The string is only valid
+// until the next read.
+func (d *Decoder) queryKey() (string, error) {
+	c, err := d.PeekCode()
+	if err != nil {
+		return "", err
+	}
+	if msgpcode.IsString(c) || c == msgpcode.Nil {
+		return d.decodeStringTemp()
+	}
+	if msgpcode.IsFixedExt(c) && (d.flags&internedStringsFlag != 0 || len(d.dict) > 0) {
+		return d.decodeStringTemp()
+	}
+	v, err := d.decodeInterfaceCond()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(v), nil
+}
+
+// subDecoder returns a decoder that reads b with the same configuration
+// and nesting depth as d.
+func (d *Decoder) subDecoder(b []byte) *Decoder {
+	sub := new(Decoder)
+	*sub = *d
+	sub.buf = nil
+	sub.rec = nil
+	sub.resetBytes(b)
+	sub.depth = d.depth
+	return sub
+}
+
+// ------------------------------------------------------------------------------
+
+func (seg *querySegment) match(key string, index, n int) bool {
+	if seg.wildcard {
+		return true
+	}
+	if index == -1 {
+		return !seg.isSlice && key == seg.key
+	}
+
+	if seg.isSlice {
+		start, end := 0, n
+		if seg.hasStart {
+			start = clampIndex(seg.start, n)
+		}
+		if seg.hasEnd {
+			end = clampIndex(seg.end, n)
+		}
+		return index >= start && index < end
+	}
+	return seg.isIndex && resolveIndex(seg.index, n) == index
+}
+
+// resolveIndex resolves a negative index from the end of an array of n
+// elements. An index out of range stays out of range, so it matches nothing.
+func resolveIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+// clampIndex resolves a slice bound like resolveIndex, but clamps it
+// to the start of the array.
+func clampIndex(i, n int) int {
+	i = resolveIndex(i, n)
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+func (f *queryFilter) match(v interface{}) bool {
+	for i := range f.path {
+		var ok bool
+		v, ok = f.path[i].lookup(v)
+		if !ok {
+			return false
+		}
+	}
+
+	switch f.op {
+	case "":
+		return v != nil && v != false
+	case "==":
+		return compareQueryValues(v, f.value) == 0
+	case "!=":
+		return compareQueryValues(v, f.value) != 0
+	}
+
+	cmp := compareQueryValues(v, f.value)
+	switch f.op {
+	case "<":
+		return cmp == -1
+	case "<=":
+		return cmp == -1 || cmp == 0
+	case ">":
+		return cmp == 1
+	case ">=":
+		return cmp == 1 || cmp == 0
+	}
+	return false
+}
+
+// lookup returns the child of a decoded map or slice.
+func (seg *querySegment) lookup(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		child, ok := v[seg.key]
+		return child, ok
+	case map[interface{}]interface{}:
+		for k, child := range v {
+			if fmt.Sprint(k) == seg.key {
+				return child, true
+			}
+		}
+	case []interface{}:
+		if !seg.isIndex {
+			return nil, false
+		}
+		i := resolveIndex(seg.index, len(v))
+		if i >= 0 && i < len(v) {
+			return v[i], true
+		}
+	}
+	return nil, false
+}
+
+// compareQueryValues returns -1, 0 or 1 when a is less than, equal to
+// or greater than b, and 2 when they can't be compared.
+func compareQueryValues(a, b interface{}) int {
+	switch b := b.(type) {
+	case nil:
+		if a == nil {
+			return 0
+		}
+	case bool:
+		if a, ok := a.(bool); ok && a == b {
+			return 0
+		}
+	case string:
+		switch a := a.(type) {
+		case string:
+			return strings.Compare(a, b)
+		case []byte:
+			return strings.Compare(string(a), b)
+		}
+	case float64:
+		switch a.(type) {
+		case int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64:
+			f, _ := ToFloat64E(a)
+			switch {
+			case f < b:
+				return -1
+			case f > b:
+				return 1
+			case f == b:
+				return 0
+			}
+		}
+	}
+	return 2
+}
+
+// ------------------------------------------------------------------------------
+
+// CompileQuery parses a query using the syntax described in Decoder.Query.
+func CompileQuery(s string) (*Query, error) {
+	p := queryParser{s: s}
+	segs, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{
+		src:    s,
+		segs:   segs,
+		single: true,
+		plain:  isPlainQuery(s),
+	}
+	for i := range segs {
+		if !segs[i].isSingle() {
+			q.single = false
+		}
+	}
+	return q, nil
+}
+
+// MustCompileQuery is like CompileQuery, but panics if the query is invalid.
+func MustCompileQuery(s string) *Query {
+	q, err := CompileQuery(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+func (seg *querySegment) isSingle() bool {
+	return !seg.wildcard && !seg.isSlice && seg.filter == nil && !seg.recursive
+}
+
+type queryParser struct {
+	s   string
+	pos int
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("msgpack: invalid query %q at offset %d: %s",
+		p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+// parse parses segments until the end of the query. In a filter path
+// it stops at the first operator or space.
+func (p *queryParser) parse(filter bool) ([]querySegment, error) {
+	var segs []querySegment
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if filter && strings.IndexByte("=!<> ]", c) != -1 {
+			break
+		}
+
+		recursive := false
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], ".."):
+			if filter {
+				return nil, p.errorf("recursive descent is not allowed in filters")
+			}
+			recursive = true
+			p.pos += 2
+		case c == '.':
+			if len(segs) == 0 {
+				return nil, p.errorf("unexpected '.'")
+			}
+			p.pos++
+		case c == '[':
+		case len(segs) > 0:
+			return nil, p.errorf("expected '.' or '['")
+		}
+
+		if p.pos == len(p.s) {
+			return nil, p.errorf("unexpected end of query")
+		}
+
+		seg, err := p.parseSegment(filter)
+		if err != nil {
+			return nil, err
+		}
+		seg.recursive = recursive
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+func (p *queryParser) parseSegment(filter bool) (querySegment, error) {
+	switch c := p.s[p.pos]; c {
+	case '[':
+		p.pos++
+		return p.parseBracket(filter)
+	case '*':
+		if filter {
+			return querySegment{}, p.errorf("wildcards are not allowed in filters")
+		}
+		p.pos++
+		return querySegment{wildcard: true}, nil
+	case '"', '\'':
+		key, err := p.parseQuoted()
+		if err != nil {
+			return querySegment{}, err
+		}
+		return querySegment{key: key}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(".[]", p.s[p.pos]) == -1 {
+		if filter && strings.IndexByte("=!<> ", p.s[p.pos]) != -1 {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return querySegment{}, p.errorf("expected a key")
+	}
+	return newKeySegment(p.s[start:p.pos]), nil
+}
+
+func newKeySegment(key string) querySegment {
+	seg := querySegment{key: key}
+	if n, err := strconv.Atoi(key); err == nil {
+		seg.index = n
+		seg.isIndex = true
+	}
+	return seg
+}
+
+func (p *queryParser) parseBracket(filter bool) (querySegment, error) {
+	if p.pos == len(p.s) {
+		return querySegment{}, p.errorf("unexpected end of query")
+	}
+
+	var seg querySegment
+	switch c := p.s[p.pos]; c {
+	case '*':
+		if filter {
+			return seg, p.errorf("wildcards are not allowed in filters")
+		}
+		p.pos++
+		seg.wildcard = true
+	case '"', '\'':
+		key, err := p.parseQuoted()
+		if err != nil {
+			return seg, err
+		}
+		seg.key = key
+	case '?':
+		if filter {
+			return seg, p.errorf("nested filters are not supported")
+		}
+		p.pos++
+		f, err := p.parseFilter()
+		if err != nil {
+			return seg, err
+		}
+		seg.filter = f
+	default:
+		end := strings.IndexByte(p.s[p.pos:], ']')
+		if end == -1 {
+			return seg, p.errorf("missing ']'")
+		}
+		s := p.s[p.pos : p.pos+end]
+		if i := strings.IndexByte(s, ':'); i != -1 {
+			if filter {
+				return seg, p.errorf("slices are not allowed in filters")
+			}
+			seg.isSlice = true
+			var err error
+			if seg.start, seg.hasStart, err = parseQueryIndex(s[:i]); err != nil {
+				return seg, p.errorf("invalid slice start %q", s[:i])
+			}
+			if seg.end, seg.hasEnd, err = parseQueryIndex(s[i+1:]); err != nil {
+				return seg, p.errorf("invalid slice end %q", s[i+1:])
+			}
+		} else {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return seg, p.errorf("invalid index %q", s)
+			}
+			seg.key = s
+			seg.index = n
+			seg.isIndex = true
+		}
+		p.pos += end
+	}
+
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return seg, p.errorf("missing ']'")
+	}
+	p.pos++
+	return seg, nil
+}
+
+func parseQueryIndex(s string) (int, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(s)
+	return n, true, err
+}
+
+func (p *queryParser) parseFilter() (*queryFilter, error) {
+	p.skipSpaces()
+	path, err := p.parse(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, p.errorf("expected a filter path")
+	}
+
+	f := &queryFilter{path: path}
+	p.skipSpaces()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			f.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if f.op == "" {
+		return f, nil
+	}
+
+	p.skipSpaces()
+	if f.value, err = p.parseLiteral(); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	return f, nil
+}
+
+func (p *queryParser) parseLiteral() (interface{}, error) {
+	if p.pos == len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	if c := p.s[p.pos]; c == '"' || c == '\'' {
+		return p.parseQuoted()
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ']' && p.s[p.pos] != ' ' {
+		p.pos++
+	}
+	switch s := p.s[start:p.pos]; s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "nil":
+		return nil, nil
+	default:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid value %q", s)
+		}
+		return f, nil
+	}
+}
+
+// parseQuoted parses a string in double or single quotes.
+// Backslash escapes the next character.
+func (p *queryParser) parseQuoted() (string, error) {
+	quote := p.s[p.pos]
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch c := p.s[i]; c {
+		case '\\':
+			i++
+			if i == len(p.s) {
+				break
+			}
+			b.WriteByte(p.s[i])
+		case quote:
+			p.pos = i + 1
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
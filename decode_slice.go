@@ -24,15 +24,22 @@ func (d *Decoder) arrayLen(c byte) (int, error) {
 	if c == msgpcode.Nil {
 		return -1, nil
 	} else if c >= msgpcode.FixedArrayLow && c <= msgpcode.FixedArrayHigh {
-		return int(c & msgpcode.FixedArrayMask), nil
+		n := int(c & msgpcode.FixedArrayMask)
+		return n, d.checkArrayLen(n)
 	}
 	switch c {
 	case msgpcode.Array16:
 		n, err := d.uint16()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkArrayLen(int(n))
 	case msgpcode.Array32:
 		n, err := d.uint32()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkArrayLen(int(n))
 	}
 	return 0, errors.Errorf("msgpack: invalid code=%x decoding array length", c)
 }
@@ -43,6 +50,11 @@ func decodeStringSliceValue(d *Decoder, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeStringSlicePtr(ptr *[]string) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	n, err := d.DecodeArrayLen()
 	if err != nil {
 		return err
@@ -55,7 +67,7 @@ func (d *Decoder) decodeStringSlicePtr(ptr *[]string) error {
 	for i := 0; i < n; i++ {
 		s, err := d.DecodeString()
 		if err != nil {
-			return err
+			return d.indexError(err, i)
 		}
 		ss = append(ss, s)
 	}
@@ -83,12 +95,20 @@ func makeStrings(s []string, n int) []string {
 }
 
 func decodeSliceValue(d *Decoder, v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	c, err := d.readCode()
 	if err != nil {
 		return err
 	}
 
 	if !msgpcode.IsArray(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return &TypeMismatchError{Kind: reflect.Slice, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return err
@@ -124,7 +144,7 @@ func decodeSliceValue(d *Decoder, v reflect.Value) error {
 		}
 		elem := v.Index(i)
 		if err := d.DecodeValue(elem); err != nil {
-			return err
+			return d.indexError(err, i)
 		}
 	}
 
@@ -141,12 +161,20 @@ func growSliceValue(v reflect.Value, n int) reflect.Value {
 }
 
 func decodeArrayValue(d *Decoder, v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	c, err := d.readCode()
 	if err != nil {
 		return err
 	}
 
 	if !msgpcode.IsArray(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return &TypeMismatchError{Kind: reflect.Array, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return err
@@ -171,7 +199,7 @@ func decodeArrayValue(d *Decoder, v reflect.Value) error {
 	for i := 0; i < n; i++ {
 		sv := v.Index(i)
 		if err := d.DecodeValue(sv); err != nil {
-			return err
+			return d.indexError(err, i)
 		}
 	}
 
@@ -187,6 +215,11 @@ func (d *Decoder) DecodeSlice() ([]interface{}, error) {
 }
 
 func (d *Decoder) decodeSlice(c byte) ([]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
 	n, err := d.arrayLen(c)
 	if err != nil {
 		return nil, err
@@ -199,7 +232,7 @@ func (d *Decoder) decodeSlice(c byte) ([]interface{}, error) {
 	for i := 0; i < n; i++ {
 		v, err := d.decodeInterfaceCond()
 		if err != nil {
-			return nil, err
+			return nil, d.indexError(err, i)
 		}
 		s = append(s, v)
 	}
@@ -208,6 +241,11 @@ func (d *Decoder) decodeSlice(c byte) ([]interface{}, error) {
 }
 
 func (d *Decoder) skipSlice(c byte) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
 	n, err := d.arrayLen(c)
 	if err != nil {
 		return err
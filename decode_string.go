@@ -15,26 +15,38 @@ func (d *Decoder) bytesLen(c byte) (int, error) {
 	}
 
 	if msgpcode.IsFixedString(c) {
-		return int(c & msgpcode.FixedStrMask), nil
+		n := int(c & msgpcode.FixedStrMask)
+		return n, d.checkBytesLen(c, n)
 	}
 
+	var n int
 	switch c {
 	case msgpcode.Str8, msgpcode.Bin8:
-		n, err := d.uint8()
-		return int(n), err
+		n8, err := d.uint8()
+		if err != nil {
+			return 0, err
+		}
+		n = int(n8)
 	case msgpcode.Str16, msgpcode.Bin16:
-		n, err := d.uint16()
-		return int(n), err
+		n16, err := d.uint16()
+		if err != nil {
+			return 0, err
+		}
+		n = int(n16)
 	case msgpcode.Str32, msgpcode.Bin32:
-		n, err := d.uint32()
-		return int(n), err
+		n32, err := d.uint32()
+		if err != nil {
+			return 0, err
+		}
+		n = int(n32)
+	default:
+		return 0, errors.Errorf("msgpack: invalid code=%x decoding string/bytes length", c)
 	}
-
-	return 0, errors.Errorf("msgpack: invalid code=%x decoding string/bytes length", c)
+	return n, d.checkBytesLen(c, n)
 }
 
 func (d *Decoder) DecodeString() (string, error) {
-	if intern := d.flags&useInternedStringsFlag != 0; intern || len(d.dict) > 0 {
+	if intern := d.flags&internedStringsFlag != 0; intern || len(d.dict) > 0 {
 		return d.decodeInternedString(intern)
 	}
 
@@ -44,11 +56,19 @@ func (d *Decoder) DecodeString() (string, error) {
 	}
 
 	if !msgpcode.IsString(c) && !msgpcode.IsBin(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return "", &TypeMismatchError{Kind: reflect.String, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return "", err
 		}
-		return ToString(val), nil
+		str, err := ToStringE(val)
+		if err != nil {
+			logConversionError(err)
+			return str, nil
+		}
+		return str, nil
 	}
 
 	return d.string(c)
@@ -67,6 +87,9 @@ func (d *Decoder) stringWithLen(n int) (string, error) {
 		return "", nil
 	}
 	b, err := d.readN(n)
+	if d.fromBytes && d.flags&zeroCopyFlag != 0 {
+		return bytesToString(b), err
+	}
 	return string(b), err
 }
 
@@ -103,11 +126,26 @@ func (d *Decoder) bytes(c byte, b []byte) ([]byte, error) {
 	if n == -1 {
 		return nil, nil
 	}
-	return readN(d.r, b, n)
+	if d.fromBytes {
+		return d.readBytesInto(b, n)
+	}
+	b, err = readN(d.r, b, n)
+	if err != nil {
+		return b, err
+	}
+	d.offset += int64(n)
+	return b, nil
+}
+
+// DecodeKey decodes a string without copying it. The string is only valid
+// until the next read from the Decoder, so it is meant for lookups like
+// matching struct field names in a switch statement.
+func (d *Decoder) DecodeKey() (string, error) {
+	return d.decodeStringTemp()
 }
 
 func (d *Decoder) decodeStringTemp() (string, error) {
-	if intern := d.flags&useInternedStringsFlag != 0; intern || len(d.dict) > 0 {
+	if intern := d.flags&internedStringsFlag != 0; intern || len(d.dict) > 0 {
 		return d.decodeInternedString(intern)
 	}
 
@@ -149,9 +187,33 @@ func (d *Decoder) bytesPtr(c byte, ptr *[]byte) error {
 		*ptr = nil
 		return nil
 	}
+	if d.fromBytes {
+		*ptr, err = d.readBytesInto(*ptr, n)
+		return err
+	}
 
 	*ptr, err = readN(d.r, *ptr, n)
-	return err
+	if err != nil {
+		return err
+	}
+	d.offset += int64(n)
+	return nil
+}
+
+// readBytesInto is like readN for a Decoder reset with ResetBytes, but
+// returns bytes that outlive the next read, reusing b when possible.
+func (d *Decoder) readBytesInto(b []byte, n int) ([]byte, error) {
+	src, err := d.readBytes(nil, n, true)
+	if err != nil {
+		return nil, err
+	}
+	if d.flags&zeroCopyFlag != 0 {
+		return src, nil
+	}
+	if b == nil {
+		b = make([]byte, 0, n)
+	}
+	return append(b[:0], src...), nil
 }
 
 func (d *Decoder) skipBytes(c byte) error {
@@ -172,6 +234,9 @@ func decodeBytesValue(d *Decoder, v reflect.Value) error {
 	}
 
 	if !msgpcode.IsBin(c) && !msgpcode.IsString(c) && c != msgpcode.Nil {
+		if d.flags&strictTypesFlag != 0 {
+			return &TypeMismatchError{Kind: reflect.Slice, Code: c}
+		}
 		val, err := d.decodeInterfaceFromCode(c)
 		if err != nil {
 			return err
@@ -134,6 +134,11 @@ func ptrValueDecoder(typ reflect.Type) decoderFunc {
 		if v.IsNil() {
 			v.Set(reflect.New(v.Type().Elem()))
 		}
+		if d.extRegistry != nil {
+			if fn, ok := d.extRegistry.decoder(typ.Elem()); ok {
+				return fn(d, v.Elem())
+			}
+		}
 		return decoder(d, v.Elem())
 	}
 }
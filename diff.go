@@ -0,0 +1,691 @@
+package msgpack
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// diffMaxDepth limits the nesting of arrays and maps accepted by Diff.
+const diffMaxDepth = 10000
+
+// DiffKind is the kind of a Difference.
+type DiffKind int
+
+const (
+	// DiffValue means that the values differ.
+	DiffValue DiffKind = iota
+	// DiffType means that the values have different types, e.g. a string
+	// and an integer.
+	DiffType
+	// DiffWidth means that the numbers are equal, but are encoded with
+	// different codes, e.g. int8 and int64.
+	DiffWidth
+	// DiffAdded means that the map key or array element is only in b.
+	DiffAdded
+	// DiffRemoved means that the map key or array element is only in a.
+	DiffRemoved
+	// DiffKeyOrder means that the maps have their common keys in
+	// a different order.
+	DiffKeyOrder
+	// DiffExtType means that the extensions have different ids.
+	DiffExtType
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffValue:
+		return "value changed"
+	case DiffType:
+		return "type changed"
+	case DiffWidth:
+		return "width changed"
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffKeyOrder:
+		return "keys reordered"
+	case DiffExtType:
+		return "ext type changed"
+	}
+	return "DiffKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Difference is a difference between two MessagePack documents found by Diff.
+type Difference struct {
+	Kind DiffKind
+	// Path is the path of the value in the syntax of Decoder.Query,
+	// e.g. items[1].name. It is empty for the top-level value.
+	Path string
+	// A and B are the values in a and b decoded like DecodeInterface, with
+	// unknown extensions decoded as *RawExt. They are nil when the value
+	// is missing. For DiffKeyOrder they are the map keys in order.
+	A, B interface{}
+	// CodeA and CodeB are the first codes of the values.
+	CodeA, CodeB byte
+	// OffsetA and OffsetB are the offsets of the values, or -1 when the
+	// value is missing.
+	OffsetA, OffsetB int64
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "<root>"
+	}
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s: %s %s", path, d.Kind, formatDiffValue(d.B, d.CodeB))
+	case DiffRemoved:
+		return fmt.Sprintf("%s: %s %s", path, d.Kind, formatDiffValue(d.A, d.CodeA))
+	}
+	return fmt.Sprintf("%s: %s: %s != %s",
+		path, d.Kind, formatDiffValue(d.A, d.CodeA), formatDiffValue(d.B, d.CodeB))
+}
+
+func formatDiffValue(v interface{}, c byte) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q (%s)", s, msgpcode.Name(c))
+	}
+	return fmt.Sprintf("%v (%s)", v, msgpcode.Name(c))
+}
+
+// DiffOptions controls what Diff reports.
+type DiffOptions struct {
+	// IgnoreKeyOrder disables DiffKeyOrder.
+	IgnoreKeyOrder bool
+	// IgnoreNumericWidth disables DiffWidth.
+	IgnoreNumericWidth bool
+}
+
+// Diff walks the MessagePack values a and b in parallel and returns their
+// differences in the order they are found. Map values are matched by key
+// and array elements by index. Diff compares values rather than bytes, so
+// the lengths of strings, arrays and maps encoded with different widths
+// are not reported.
+func Diff(a, b []byte) ([]Difference, error) {
+	return DiffWithOptions(a, b, DiffOptions{})
+}
+
+// DiffWithOptions is like Diff, but honours the options.
+func DiffWithOptions(a, b []byte, opts DiffOptions) ([]Difference, error) {
+	df := &differ{
+		opts:  opts,
+		a:     newDiffDecoder(a),
+		b:     newDiffDecoder(b),
+		endsA: make(map[int64]int64),
+		endsB: make(map[int64]int64),
+	}
+	if err := df.value(0, 0); err != nil {
+		return nil, err
+	}
+
+	for _, d := range []*Decoder{df.a, df.b} {
+		d.offset = 0
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		if d.offset != int64(len(d.data)) {
+			return nil, errors.Errorf("msgpack: unexpected data at offset %d after the value", d.offset)
+		}
+	}
+	return df.diffs, nil
+}
+
+func newDiffDecoder(data []byte) *Decoder {
+	d := new(Decoder)
+	d.ResetBytes(data)
+	d.UseRawExt(true)
+	d.SetLimits(Limits{MaxDepth: diffMaxDepth})
+	return d
+}
+
+type differ struct {
+	opts  DiffOptions
+	a, b  *Decoder
+	diffs []Difference
+
+	path []byte // path of the current value
+
+	// End offsets of the containers skipped so far, by start offset.
+	endsA, endsB map[int64]int64
+}
+
+// peekAt returns the code of the value at offset off.
+func peekAt(d *Decoder, off int64) (byte, error) {
+	d.offset = off
+	return d.PeekCode()
+}
+
+// decodeAt decodes the value at offset off.
+func decodeAt(d *Decoder, off int64) (interface{}, error) {
+	d.offset = off
+	return d.DecodeInterface()
+}
+
+func (df *differ) add(kind DiffKind, offA, offB int64) error {
+	diff := Difference{
+		Kind:    kind,
+		Path:    string(df.path),
+		OffsetA: offA,
+		OffsetB: offB,
+	}
+	if offA >= 0 {
+		diff.CodeA = df.a.data[offA]
+		v, err := decodeAt(df.a, offA)
+		if err != nil {
+			return err
+		}
+		diff.A = v
+	}
+	if offB >= 0 {
+		diff.CodeB = df.b.data[offB]
+		v, err := decodeAt(df.b, offB)
+		if err != nil {
+			return err
+		}
+		diff.B = v
+	}
+	df.diffs = append(df.diffs, diff)
+	return nil
+}
+
+const (
+	diffNil = iota
+	diffBool
+	diffInt
+	diffFloat
+	diffString
+	diffBin
+	diffArray
+	diffMap
+	diffExt
+)
+
+func diffFamily(c byte) (int, error) {
+	switch {
+	case c == msgpcode.Nil:
+		return diffNil, nil
+	case msgpcode.IsBool(c):
+		return diffBool, nil
+	case msgpcode.IsFixedNum(c), msgpcode.IsInt(c), msgpcode.IsUInt(c):
+		return diffInt, nil
+	case msgpcode.IsFloat(c):
+		return diffFloat, nil
+	case msgpcode.IsString(c):
+		return diffString, nil
+	case msgpcode.IsBin(c):
+		return diffBin, nil
+	case msgpcode.IsArray(c):
+		return diffArray, nil
+	case msgpcode.IsMap(c):
+		return diffMap, nil
+	case msgpcode.IsExt(c):
+		return diffExt, nil
+	}
+	return 0, errors.Errorf("msgpack: unknown code %x", c)
+}
+
+func (df *differ) value(offA, offB int64) error {
+	ca, err := peekAt(df.a, offA)
+	if err != nil {
+		return err
+	}
+	cb, err := peekAt(df.b, offB)
+	if err != nil {
+		return err
+	}
+	fa, err := diffFamily(ca)
+	if err != nil {
+		return err
+	}
+	fb, err := diffFamily(cb)
+	if err != nil {
+		return err
+	}
+	if fa != fb {
+		return df.add(DiffType, offA, offB)
+	}
+
+	switch fa {
+	case diffArray:
+		return df.array(offA, offB)
+	case diffMap:
+		return df.mapValue(offA, offB)
+	case diffExt:
+		return df.ext(offA, offB)
+	}
+
+	va, err := decodeAt(df.a, offA)
+	if err != nil {
+		return err
+	}
+	vb, err := decodeAt(df.b, offB)
+	if err != nil {
+		return err
+	}
+
+	var equal bool
+	switch fa {
+	case diffInt:
+		equal = diffIntBits(va) == diffIntBits(vb) && diffIsNeg(va) == diffIsNeg(vb)
+	case diffFloat:
+		x, y := diffFloat64(va), diffFloat64(vb)
+		equal = x == y || math.IsNaN(x) && math.IsNaN(y)
+	default:
+		equal = reflect.DeepEqual(va, vb)
+	}
+
+	switch {
+	case !equal:
+		return df.add(DiffValue, offA, offB)
+	case ca != cb && (fa == diffInt || fa == diffFloat) && !df.opts.IgnoreNumericWidth:
+		return df.add(DiffWidth, offA, offB)
+	}
+	return nil
+}
+
+// diffIntBits returns the bits of an integer returned by DecodeInterface.
+func diffIntBits(v interface{}) uint64 {
+	switch v := v.(type) {
+	case int8:
+		return uint64(v)
+	case int16:
+		return uint64(v)
+	case int32:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	}
+	return 0
+}
+
+func diffIsNeg(v interface{}) bool {
+	switch v := v.(type) {
+	case int8:
+		return v < 0
+	case int16:
+		return v < 0
+	case int32:
+		return v < 0
+	case int64:
+		return v < 0
+	}
+	return false
+}
+
+func diffFloat64(v interface{}) float64 {
+	if f, ok := v.(float32); ok {
+		return float64(f)
+	}
+	f, _ := v.(float64)
+	return f
+}
+
+func (df *differ) ext(offA, offB int64) error {
+	idA, dataA, err := extAt(df.a, offA)
+	if err != nil {
+		return err
+	}
+	idB, dataB, err := extAt(df.b, offB)
+	if err != nil {
+		return err
+	}
+	switch {
+	case idA != idB:
+		return df.add(DiffExtType, offA, offB)
+	case !bytes.Equal(dataA, dataB):
+		return df.add(DiffValue, offA, offB)
+	}
+	return nil
+}
+
+func extAt(d *Decoder, off int64) (int8, []byte, error) {
+	d.offset = off
+	c, err := d.readCode()
+	if err != nil {
+		return 0, nil, err
+	}
+	extID, extLen, err := d.extHeader(c)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := d.readN(extLen)
+	if err != nil {
+		return 0, nil, err
+	}
+	return extID, data, nil
+}
+
+// diffCap bounds the capacity for n items read from the input by the
+// remaining data, because every item takes at least size bytes.
+func diffCap(d *Decoder, n, size int) int {
+	if max := (len(d.data) - int(d.offset)) / size; n > max {
+		return max
+	}
+	return n
+}
+
+// skipValue is like Skip, but remembers the end offsets of containers in
+// ends, so that a subtree is walked only once even though every enclosing
+// container skips over it.
+func skipValue(d *Decoder, ends map[int64]int64) error {
+	start := d.offset
+	if end, ok := ends[start]; ok {
+		d.offset = end
+		return nil
+	}
+
+	c, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+	isMap := msgpcode.IsMap(c)
+	if !isMap && !msgpcode.IsArray(c) {
+		return d.Skip()
+	}
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	if _, err := d.readCode(); err != nil {
+		return err
+	}
+	var n int
+	if isMap {
+		n, err = d.mapLen(c)
+		n *= 2
+	} else {
+		n, err = d.arrayLen(c)
+	}
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := skipValue(d, ends); err != nil {
+			return err
+		}
+	}
+
+	ends[start] = d.offset
+	return nil
+}
+
+// elementsAt returns the offsets of the elements of the array at offset off.
+func elementsAt(d *Decoder, ends map[int64]int64, off int64) ([]int64, error) {
+	d.offset = off
+	c, err := d.readCode()
+	if err != nil {
+		return nil, err
+	}
+	n, err := d.arrayLen(c)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, 0, diffCap(d, n, 1))
+	for i := 0; i < n; i++ {
+		offsets = append(offsets, d.offset)
+		if err := skipValue(d, ends); err != nil {
+			return nil, err
+		}
+	}
+	return offsets, nil
+}
+
+func (df *differ) array(offA, offB int64) error {
+	elemsA, err := elementsAt(df.a, df.endsA, offA)
+	if err != nil {
+		return err
+	}
+	elemsB, err := elementsAt(df.b, df.endsB, offB)
+	if err != nil {
+		return err
+	}
+
+	if err := df.a.enter(); err != nil {
+		return err
+	}
+	defer df.a.leave()
+
+	pathLen := len(df.path)
+	for i := 0; i < len(elemsA) || i < len(elemsB); i++ {
+		df.path = append(df.path, '[')
+		df.path = strconv.AppendInt(df.path, int64(i), 10)
+		df.path = append(df.path, ']')
+		switch {
+		case i >= len(elemsB):
+			err = df.add(DiffRemoved, elemsA[i], -1)
+		case i >= len(elemsA):
+			err = df.add(DiffAdded, -1, elemsB[i])
+		default:
+			err = df.value(elemsA[i], elemsB[i])
+		}
+		df.path = df.path[:pathLen]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type diffEntry struct {
+	key interface{}
+	id  string // comparable form of the key
+	off int64  // offset of the value
+}
+
+// entriesAt returns the entries of the map at offset off.
+func entriesAt(d *Decoder, ends map[int64]int64, off int64) ([]diffEntry, error) {
+	d.offset = off
+	c, err := d.readCode()
+	if err != nil {
+		return nil, err
+	}
+	n, err := d.mapLen(c)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]diffEntry, 0, diffCap(d, n, 2))
+	for i := 0; i < n; i++ {
+		key, err := d.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, diffEntry{
+			key: key,
+			id:  diffKeyID(key),
+			off: d.offset,
+		})
+		if err := skipValue(d, ends); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// diffKeyID returns a string that is equal for equal keys, so that keys
+// encoded with different widths match.
+func diffKeyID(key interface{}) string {
+	switch key := key.(type) {
+	case string:
+		return "s" + key
+	case []byte:
+		return "b" + string(key)
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		if diffIsNeg(key) {
+			return "i" + strconv.FormatInt(int64(diffIntBits(key)), 10)
+		}
+		return "i" + strconv.FormatUint(diffIntBits(key), 10)
+	case float32, float64:
+		return "f" + strconv.FormatFloat(diffFloat64(key), 'g', -1, 64)
+	}
+	return fmt.Sprintf("%T %v", key, key)
+}
+
+func (df *differ) mapValue(offA, offB int64) error {
+	entriesA, err := entriesAt(df.a, df.endsA, offA)
+	if err != nil {
+		return err
+	}
+	entriesB, err := entriesAt(df.b, df.endsB, offB)
+	if err != nil {
+		return err
+	}
+
+	if err := df.a.enter(); err != nil {
+		return err
+	}
+	defer df.a.leave()
+
+	indexB := make(map[string]int, len(entriesB))
+	for i, e := range entriesB {
+		if _, ok := indexB[e.id]; !ok {
+			indexB[e.id] = i
+		}
+	}
+	inA := make(map[string]bool, len(entriesA))
+	for _, e := range entriesA {
+		inA[e.id] = true
+	}
+
+	if !df.opts.IgnoreKeyOrder && !sameKeyOrder(entriesA, entriesB, inA, indexB) {
+		keysA := make([]interface{}, len(entriesA))
+		for i, e := range entriesA {
+			keysA[i] = e.key
+		}
+		keysB := make([]interface{}, len(entriesB))
+		for i, e := range entriesB {
+			keysB[i] = e.key
+		}
+		df.diffs = append(df.diffs, Difference{
+			Kind:    DiffKeyOrder,
+			Path:    string(df.path),
+			A:       keysA,
+			B:       keysB,
+			CodeA:   df.a.data[offA],
+			CodeB:   df.b.data[offB],
+			OffsetA: offA,
+			OffsetB: offB,
+		})
+	}
+
+	pathLen := len(df.path)
+	for _, e := range entriesA {
+		df.path = appendDiffPath(df.path, e.key)
+		if i, ok := indexB[e.id]; ok {
+			err = df.value(e.off, entriesB[i].off)
+		} else {
+			err = df.add(DiffRemoved, e.off, -1)
+		}
+		df.path = df.path[:pathLen]
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range entriesB {
+		if inA[e.id] {
+			continue
+		}
+		df.path = appendDiffPath(df.path, e.key)
+		err := df.add(DiffAdded, -1, e.off)
+		df.path = df.path[:pathLen]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameKeyOrder reports whether the keys present in both maps are in the
+// same order.
+func sameKeyOrder(entriesA, entriesB []diffEntry, inA map[string]bool, indexB map[string]int) bool {
+	j := 0
+	for _, e := range entriesA {
+		if _, ok := indexB[e.id]; !ok {
+			continue
+		}
+		for j < len(entriesB) && !inA[entriesB[j].id] {
+			j++
+		}
+		if j == len(entriesB) || entriesB[j].id != e.id {
+			return false
+		}
+		j++
+	}
+	return true
+}
+
+// appendDiffPath appends a map key to path using the syntax of Decoder.Query.
+// Query matches other keys than strings by their fmt.Sprint form, so they
+// are written as integer indexes or quoted keys, and nil as "".
+func appendDiffPath(path []byte, key interface{}) []byte {
+	var s string
+	switch key := key.(type) {
+	case string:
+		s = key
+	case nil:
+	default:
+		s = fmt.Sprint(key)
+		if _, err := strconv.Atoi(s); err == nil {
+			path = append(path, '[')
+			path = append(path, s...)
+			return append(path, ']')
+		}
+		return appendQuotedQueryKey(path, s)
+	}
+	if isPlainQueryKey(s) {
+		if len(path) > 0 {
+			path = append(path, '.')
+		}
+		return append(path, s...)
+	}
+	return appendQuotedQueryKey(path, s)
+}
+
+// appendQuotedQueryKey appends key in brackets and quotes like the quoted
+// keys of Decoder.Query.
+func appendQuotedQueryKey(path []byte, key string) []byte {
+	path = append(path, '[', '"')
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c == '"' || c == '\\' {
+			path = append(path, '\\')
+		}
+		path = append(path, key[i])
+	}
+	return append(path, '"', ']')
+}
+
+// isPlainQueryKey reports whether key can be used in a query without quotes.
+func isPlainQueryKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	if _, err := strconv.Atoi(key); err == nil {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
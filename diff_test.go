@@ -0,0 +1,202 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		require.Nil(t, err)
+		return b
+	}
+
+	tests := []struct {
+		a, b  string
+		opts  msgpack.DiffOptions
+		diffs []string
+	}{
+		{"01", "01", msgpack.DiffOptions{}, nil},
+		{"01", "02", msgpack.DiffOptions{}, []string{
+			"<root>: value changed: 1 (positive fixint) != 2 (positive fixint)",
+		}},
+		{"01", "d30000000000000001", msgpack.DiffOptions{}, []string{
+			"<root>: width changed: 1 (positive fixint) != 1 (int64)",
+		}},
+		{"01", "d30000000000000001", msgpack.DiffOptions{IgnoreNumericWidth: true}, nil},
+		{"ff", "cfffffffffffffffff", msgpack.DiffOptions{}, []string{
+			"<root>: value changed: -1 (negative fixint) != 18446744073709551615 (uint64)",
+		}},
+		{"ca3fc00000", "cb3ff8000000000000", msgpack.DiffOptions{}, []string{
+			"<root>: width changed: 1.5 (float32) != 1.5 (float64)",
+		}},
+		{"a131", "01", msgpack.DiffOptions{}, []string{
+			`<root>: type changed: "1" (fixstr) != 1 (positive fixint)`,
+		}},
+		// String lengths encoded with different widths are equal.
+		{"a161", "d90161", msgpack.DiffOptions{}, nil},
+		{"d46401", "d46501", msgpack.DiffOptions{}, []string{
+			"<root>: ext type changed: &{100 [1]} (fixext1) != &{101 [1]} (fixext1)",
+		}},
+		{"920102", "93010304", msgpack.DiffOptions{}, []string{
+			"[1]: value changed: 2 (positive fixint) != 3 (positive fixint)",
+			"[2]: added 4 (positive fixint)",
+		}},
+		{"93010203", "9101", msgpack.DiffOptions{}, []string{
+			"[1]: removed 2 (positive fixint)",
+			"[2]: removed 3 (positive fixint)",
+		}},
+		// {"a": 1, "b": 2} and {"c": 3, "b": 2, "a": 1}
+		{"82a16101a16202", "83a16303a16202a16101", msgpack.DiffOptions{}, []string{
+			"<root>: keys reordered: [a b] (fixmap) != [c b a] (fixmap)",
+			"c: added 3 (positive fixint)",
+		}},
+		{"82a16101a16202", "83a16303a16202a16101", msgpack.DiffOptions{IgnoreKeyOrder: true}, []string{
+			"c: added 3 (positive fixint)",
+		}},
+		// {"a": 1, "b": 2} and {"b": 2, "a": 1} with the keys in different widths.
+		{"82a16101a16202", "82d9016202d9016101", msgpack.DiffOptions{IgnoreKeyOrder: true}, nil},
+		// {"x.y": {1: [true]}} and {"x.y": {1: [false]}, "z": nil}
+		{"81a3782e798101 91c3", "82a3782e798101 91c2a17ac0", msgpack.DiffOptions{}, []string{
+			`["x.y"][1][0]: value changed: true (true) != false (false)`,
+			"z: added <nil> (nil)",
+		}},
+	}
+	for _, test := range tests {
+		a := mustHex(removeSpaces(test.a))
+		b := mustHex(removeSpaces(test.b))
+		diffs, err := msgpack.DiffWithOptions(a, b, test.opts)
+		require.Nil(t, err, test.a)
+
+		var got []string
+		for _, d := range diffs {
+			got = append(got, d.String())
+		}
+		require.Equal(t, test.diffs, got, "%s %s", test.a, test.b)
+	}
+}
+
+func removeSpaces(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+func TestDiffValues(t *testing.T) {
+	type item struct {
+		ID   int64
+		Name string
+		At   time.Time
+	}
+	a, err := msgpack.Marshal([]item{{ID: 1, Name: "a", At: time.Unix(1, 0)}})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCanonicalEncoding(true)
+	require.Nil(t, enc.Encode([]item{{ID: 1, Name: "b", At: time.Unix(1, 0)}}))
+	b := buf.Bytes()
+
+	diffs, err := msgpack.Diff(a, b)
+	require.Nil(t, err)
+	require.Len(t, diffs, 4)
+	require.Equal(t, msgpack.DiffKeyOrder, diffs[0].Kind)
+	require.Equal(t, []interface{}{"ID", "Name", "At"}, diffs[0].A)
+	require.Equal(t, []interface{}{"At", "ID", "Name"}, diffs[0].B)
+	require.Equal(t, msgpack.Difference{
+		Kind:    msgpack.DiffWidth,
+		Path:    "[0].ID",
+		A:       int64(1),
+		B:       int8(1),
+		CodeA:   msgpcode.Int64,
+		CodeB:   1,
+		OffsetA: 5,
+		OffsetB: 14,
+	}, diffs[1])
+	require.Equal(t, "[0].Name", diffs[2].Path)
+	require.Equal(t, "a", diffs[2].A)
+	require.Equal(t, "b", diffs[2].B)
+	require.Equal(t, msgpack.DiffExtType, diffs[3].Kind)
+	require.Equal(t, "[0].At", diffs[3].Path)
+
+	diffs, err = msgpack.DiffWithOptions(a, b, msgpack.DiffOptions{
+		IgnoreKeyOrder:     true,
+		IgnoreNumericWidth: true,
+	})
+	require.Nil(t, err)
+	require.Len(t, diffs, 2)
+
+	_, err = msgpack.Diff(a, a[:len(a)-1])
+	require.NotNil(t, err)
+	_, err = msgpack.Diff(a, append(a, 0xc0))
+	require.NotNil(t, err)
+
+	// Huge lengths are not allocated up front.
+	for _, huge := range []string{"ddffffffff", "dfffffffff"} {
+		b, _ := hex.DecodeString(huge)
+		_, err = msgpack.Diff(b, b)
+		require.NotNil(t, err, huge)
+	}
+}
+
+func TestDiffPathQuery(t *testing.T) {
+	keys := []interface{}{true, 1.5, int64(3), int64(-4), uint64(1 << 63), nil, "x.y", "p", "1", `a"b`}
+	ma := make(map[interface{}]interface{}, len(keys))
+	mb := make(map[interface{}]interface{}, len(keys)+1)
+	for i, key := range keys {
+		ma[key] = []int{i}
+		mb[key] = []int{i + 100}
+	}
+	mb[false] = "added"
+
+	a, err := msgpack.Marshal(map[string]interface{}{"k": ma})
+	require.Nil(t, err)
+	b, err := msgpack.Marshal(map[string]interface{}{"k": mb})
+	require.Nil(t, err)
+
+	diffs, err := msgpack.DiffWithOptions(a, b, msgpack.DiffOptions{IgnoreKeyOrder: true})
+	require.Nil(t, err)
+	require.Len(t, diffs, len(keys)+1)
+
+	// Every path finds the value it describes.
+	for _, d := range diffs {
+		if d.A != nil {
+			values, err := msgpack.NewDecoder(bytes.NewReader(a)).Query(d.Path)
+			require.Nil(t, err, d.Path)
+			require.Equal(t, []interface{}{d.A}, values, d.Path)
+		}
+		values, err := msgpack.NewDecoder(bytes.NewReader(b)).Query(d.Path)
+		require.Nil(t, err, d.Path)
+		require.Equal(t, []interface{}{d.B}, values, d.Path)
+	}
+}
+
+func TestDiffDeep(t *testing.T) {
+	// Every subtree is walked once, so deep nesting takes linear time.
+	const depth = 9000
+	for _, prefix := range [][]byte{{0x91}, {0x81, 0xa1, 'k'}} {
+		a := append(bytes.Repeat(prefix, depth), 1)
+		b := append(bytes.Repeat(prefix, depth), 2)
+
+		diffs, err := msgpack.Diff(a, b)
+		require.Nil(t, err)
+		require.Len(t, diffs, 1)
+		require.Equal(t, msgpack.DiffValue, diffs[0].Kind)
+		require.Equal(t, int64(len(a)-1), diffs[0].OffsetA)
+
+		values, err := msgpack.NewDecoder(bytes.NewReader(b)).Query(diffs[0].Path)
+		require.Nil(t, err)
+		require.Equal(t, []interface{}{int8(2)}, values)
+	}
+}
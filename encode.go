@@ -1,6 +1,7 @@
 package msgpack
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"reflect"
@@ -17,6 +18,8 @@ const (
 	useCompactFloatsFlag
 	useInternedStringsFlag
 	omitEmptyFlag
+	bufferedWritesFlag
+	canonicalFlag
 )
 
 type writer interface {
@@ -53,6 +56,10 @@ func GetEncoder() *Encoder {
 
 func PutEncoder(enc *Encoder) {
 	enc.w = nil
+	enc.out = nil
+	if enc.bw != nil {
+		enc.bw.Reset(nil)
+	}
 	encPool.Put(enc)
 }
 
@@ -75,15 +82,23 @@ func Marshal(v interface{}) ([]byte, error) {
 }
 
 type Encoder struct {
-	w writer
+	w   writer
+	out writer        // the writer passed to Reset
+	bw  *bufio.Writer // buffers writes to out when bufferedWritesFlag is set
 
 	buf     []byte
 	timeBuf []byte
 
 	dict map[string]int
 
-	flags     uint32
-	structTag string
+	streams []*encStream // open BeginArray and BeginMap containers
+
+	flags      uint32
+	structTag  string
+	timeFormat TimeFormat
+	timeEncFn  func(*Encoder, time.Time) error
+
+	extRegistry *ExtRegistry
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -97,7 +112,7 @@ func NewEncoder(w io.Writer) *Encoder {
 
 // Writer returns the Encoder's writer.
 func (e *Encoder) Writer() io.Writer {
-	return e.w
+	return e.out
 }
 
 // Reset discards any buffered data, resets all state, and switches the writer to write to w.
@@ -110,6 +125,9 @@ func (e *Encoder) ResetDict(w io.Writer, dict map[string]int) {
 	e.resetWriter(w)
 	e.flags = 0
 	e.structTag = ""
+	e.timeFormat = TimeFormatMillisFloat
+	e.timeEncFn = nil
+	e.extRegistry = nil
 	e.dict = dict
 }
 
@@ -123,10 +141,15 @@ func (e *Encoder) WithDict(dict map[string]int, fn func(*Encoder) error) error {
 
 func (e *Encoder) resetWriter(w io.Writer) {
 	if bw, ok := w.(writer); ok {
-		e.w = bw
+		e.out = bw
 	} else {
-		e.w = newByteWriter(w)
+		e.out = newByteWriter(w)
 	}
+	e.w = e.out
+	// The stream state is allocated by BeginArray and BeginMap when needed.
+	// Slicing it here would push NewEncoder over the inlining budget, and
+	// the encoders that ext encoders create would escape to the heap.
+	e.streams = nil
 }
 
 // SetSortMapKeys causes the Encoder to encode map keys in increasing order.
@@ -142,12 +165,65 @@ func (e *Encoder) SetSortMapKeys(on bool) *Encoder {
 	return e
 }
 
+// UseBufferedWrites causes the Encoder to buffer encoded data and write it
+// to the underlying writer in large chunks. Call Flush to write the buffered
+// data. Disabling buffered writes flushes the buffer.
+func (e *Encoder) UseBufferedWrites(on bool) error {
+	if on == (e.flags&bufferedWritesFlag != 0) {
+		return nil
+	}
+
+	if on {
+		if e.bw == nil {
+			e.bw = bufio.NewWriter(e.out)
+		} else {
+			e.bw.Reset(e.out)
+		}
+		e.w = e.bw
+		e.flags |= bufferedWritesFlag
+		return nil
+	}
+
+	err := e.bw.Flush()
+	e.w = e.out
+	e.flags &= ^bufferedWritesFlag
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+// It is a no-op unless buffered writes are enabled.
+func (e *Encoder) Flush() error {
+	if e.flags&bufferedWritesFlag == 0 {
+		return nil
+	}
+	return e.bw.Flush()
+}
+
 // SetCustomStructTag causes the Encoder to use a custom struct tag as
 // fallback option if there is no msgpack tag.
 func (e *Encoder) SetCustomStructTag(tag string) {
 	e.structTag = tag
 }
 
+// SetTimeFormat sets the wire representation of time.Time values.
+// The default is TimeFormatMillisFloat.
+func (e *Encoder) SetTimeFormat(format TimeFormat) {
+	e.timeFormat = format
+}
+
+// SetTimeEncoder sets the function used to encode time.Time values,
+// including struct fields, slice elements and map values.
+// The function may call EncodeTime for the default behaviour.
+func (e *Encoder) SetTimeEncoder(fn func(*Encoder, time.Time) error) {
+	e.timeEncFn = fn
+}
+
+// SetExtRegistry causes the Encoder to look up extension types in r
+// before the global registry.
+func (e *Encoder) SetExtRegistry(r *ExtRegistry) {
+	e.extRegistry = r
+}
+
 // SetOmitEmpty causes the Encoder to omit empty values by default.
 func (e *Encoder) SetOmitEmpty(on bool) {
 	if on {
@@ -186,6 +262,28 @@ func (e *Encoder) UseCompactFloats(on bool) {
 	}
 }
 
+// UseCanonicalEncoding causes the Encoder to produce the same bytes for equal
+// values, so the output can be hashed, signed or used as a cache key:
+//   - keys of all maps and of structs encoded as maps are sorted by their
+//     encoded bytes,
+//   - integers and floats use the shortest form that keeps their value,
+//     e.g. float64(1.5) is encoded as float32, and NaN is encoded as
+//     the float32 quiet NaN,
+//   - time.Time is encoded as the MessagePack timestamp extension,
+//     unless a function is set with SetTimeEncoder,
+//   - strings are not interned.
+//
+// RawMessage values are normalised with Canonicalize. Values written by
+// CustomEncoder and Marshaler and arrays and maps written with BeginArray
+// and BeginMap are not.
+func (e *Encoder) UseCanonicalEncoding(on bool) {
+	if on {
+		e.flags |= canonicalFlag
+	} else {
+		e.flags &= ^canonicalFlag
+	}
+}
+
 // UseInternedStrings causes the Encoder to intern strings.
 func (e *Encoder) UseInternedStrings(on bool) {
 	if on {
@@ -220,6 +318,9 @@ func (e *Encoder) Encode(v interface{}) error {
 	case time.Duration:
 		return e.encodeInt64Cond(int64(v))
 	case time.Time:
+		if e.timeEncFn != nil {
+			return e.timeEncFn(e, v)
+		}
 		return e.EncodeTime(v)
 	}
 	return e.EncodeValue(reflect.ValueOf(v))
@@ -235,10 +336,21 @@ func (e *Encoder) EncodeMulti(v ...interface{}) error {
 }
 
 func (e *Encoder) EncodeValue(v reflect.Value) error {
-	fn := getEncoder(v.Type())
+	fn := e.getEncoder(v.Type())
 	return fn(e, v)
 }
 
+// getEncoder returns the encoder for typ, preferring the Encoder's ext
+// registry over the global one.
+func (e *Encoder) getEncoder(typ reflect.Type) encoderFunc {
+	if e.extRegistry != nil {
+		if fn, ok := e.extRegistry.encoder(typ); ok {
+			return fn
+		}
+	}
+	return getEncoder(typ)
+}
+
 func (e *Encoder) EncodeNil() error {
 	return e.writeCode(msgpcode.Nil)
 }
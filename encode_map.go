@@ -1,6 +1,7 @@
 package msgpack
 
 import (
+	"bytes"
 	"math"
 	"reflect"
 	"sort"
@@ -12,6 +13,9 @@ func encodeMapValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
 	}
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeCanonicalMap(v)
+	}
 
 	if err := e.EncodeMapLen(v.Len()); err != nil {
 		return err
@@ -34,6 +38,9 @@ func encodeMapStringStringValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
 	}
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeCanonicalMap(v)
+	}
 
 	if err := e.EncodeMapLen(v.Len()); err != nil {
 		return err
@@ -71,6 +78,9 @@ func (e *Encoder) EncodeMap(m map[string]interface{}) error {
 	if m == nil {
 		return e.EncodeNil()
 	}
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeCanonicalMap(reflect.ValueOf(m))
+	}
 	if err := e.EncodeMapLen(len(m)); err != nil {
 		return err
 	}
@@ -89,6 +99,9 @@ func (e *Encoder) EncodeMapSorted(m map[string]interface{}) error {
 	if m == nil {
 		return e.EncodeNil()
 	}
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeCanonicalMap(reflect.ValueOf(m))
+	}
 	if err := e.EncodeMapLen(len(m)); err != nil {
 		return err
 	}
@@ -133,6 +146,52 @@ func (e *Encoder) encodeSortedMapStringString(m map[string]string) error {
 	return nil
 }
 
+type canonicalMapKey struct {
+	start, end int // encoded key in the key buffer
+	value      reflect.Value
+}
+
+// encodeCanonicalMap encodes the map v with keys sorted by their encoded bytes.
+func (e *Encoder) encodeCanonicalMap(v reflect.Value) error {
+	var buf bytes.Buffer
+	ke := *e
+	ke.resetWriter(&buf)
+	ke.bw = nil
+	ke.flags &= ^bufferedWritesFlag
+
+	keys := make([]canonicalMapKey, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		start := buf.Len()
+		if err := ke.EncodeValue(iter.Key()); err != nil {
+			return err
+		}
+		keys = append(keys, canonicalMapKey{
+			start: start,
+			end:   buf.Len(),
+			value: iter.Value(),
+		})
+	}
+
+	b := buf.Bytes()
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(b[keys[i].start:keys[i].end], b[keys[j].start:keys[j].end]) < 0
+	})
+
+	if err := e.EncodeMapLen(len(keys)); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := e.write(b[k.start:k.end]); err != nil {
+			return err
+		}
+		if err := e.EncodeValue(k.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *Encoder) EncodeMapLen(l int) error {
 	if l < 16 {
 		return e.writeCode(msgpcode.FixedMapLow | byte(l))
@@ -148,7 +207,11 @@ func encodeStructValue(e *Encoder, strct reflect.Value) error {
 	if e.flags&arrayEncodedStructsFlag != 0 || structFields.AsArray {
 		return encodeStructValueAsArray(e, strct, structFields.List)
 	}
-	fields := structFields.OmitEmpty(strct, e.flags&omitEmptyFlag != 0)
+	list := structFields.List
+	if e.flags&canonicalFlag != 0 {
+		list = structFields.Sorted
+	}
+	fields := structFields.omitEmpty(list, strct, e.flags&omitEmptyFlag != 0)
 
 	if err := e.EncodeMapLen(len(fields)); err != nil {
 		return err
@@ -13,7 +13,7 @@ func (e *Encoder) EncodeUint8(n uint8) error {
 }
 
 func (e *Encoder) encodeUint8Cond(n uint8) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeUint(uint64(n))
 	}
 	return e.EncodeUint8(n)
@@ -25,7 +25,7 @@ func (e *Encoder) EncodeUint16(n uint16) error {
 }
 
 func (e *Encoder) encodeUint16Cond(n uint16) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeUint(uint64(n))
 	}
 	return e.EncodeUint16(n)
@@ -37,7 +37,7 @@ func (e *Encoder) EncodeUint32(n uint32) error {
 }
 
 func (e *Encoder) encodeUint32Cond(n uint32) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeUint(uint64(n))
 	}
 	return e.EncodeUint32(n)
@@ -49,7 +49,7 @@ func (e *Encoder) EncodeUint64(n uint64) error {
 }
 
 func (e *Encoder) encodeUint64Cond(n uint64) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeUint(n)
 	}
 	return e.EncodeUint64(n)
@@ -61,7 +61,7 @@ func (e *Encoder) EncodeInt8(n int8) error {
 }
 
 func (e *Encoder) encodeInt8Cond(n int8) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeInt(int64(n))
 	}
 	return e.EncodeInt8(n)
@@ -73,7 +73,7 @@ func (e *Encoder) EncodeInt16(n int16) error {
 }
 
 func (e *Encoder) encodeInt16Cond(n int16) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeInt(int64(n))
 	}
 	return e.EncodeInt16(n)
@@ -85,7 +85,7 @@ func (e *Encoder) EncodeInt32(n int32) error {
 }
 
 func (e *Encoder) encodeInt32Cond(n int32) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeInt(int64(n))
 	}
 	return e.EncodeInt32(n)
@@ -97,7 +97,7 @@ func (e *Encoder) EncodeInt64(n int64) error {
 }
 
 func (e *Encoder) encodeInt64Cond(n int64) error {
-	if e.flags&useCompactIntsFlag != 0 {
+	if e.flags&(useCompactIntsFlag|canonicalFlag) != 0 {
 		return e.EncodeInt(n)
 	}
 	return e.EncodeInt64(n)
@@ -142,12 +142,18 @@ func (e *Encoder) EncodeInt(n int64) error {
 	return e.EncodeInt64(n)
 }
 
+// canonicalNaN is the quiet NaN all NaNs are encoded as in canonical mode.
+const canonicalNaN = 0x7fc00000
+
 func (e *Encoder) EncodeFloat32(n float32) error {
 	if e.flags&useCompactFloatsFlag != 0 {
 		if float32(int64(n)) == n {
 			return e.EncodeInt(int64(n))
 		}
 	}
+	if e.flags&canonicalFlag != 0 && math.IsNaN(float64(n)) {
+		return e.write4(msgpcode.Float, canonicalNaN)
+	}
 	return e.write4(msgpcode.Float, math.Float32bits(n))
 }
 
@@ -161,45 +167,34 @@ func (e *Encoder) EncodeFloat64(n float64) error {
 			return e.EncodeInt(int64(n))
 		}
 	}
+	if e.flags&canonicalFlag != 0 {
+		if math.IsNaN(n) {
+			return e.write4(msgpcode.Float, canonicalNaN)
+		}
+		if float64(float32(n)) == n {
+			return e.write4(msgpcode.Float, math.Float32bits(float32(n)))
+		}
+	}
 	return e.write8(msgpcode.Double, math.Float64bits(n))
 }
 
 func (e *Encoder) write1(code byte, n uint8) error {
-	e.buf = e.buf[:2]
-	e.buf[0] = code
-	e.buf[1] = n
+	e.buf = append1(e.buf[:0], code, n)
 	return e.write(e.buf)
 }
 
 func (e *Encoder) write2(code byte, n uint16) error {
-	e.buf = e.buf[:3]
-	e.buf[0] = code
-	e.buf[1] = byte(n >> 8)
-	e.buf[2] = byte(n)
+	e.buf = append2(e.buf[:0], code, n)
 	return e.write(e.buf)
 }
 
 func (e *Encoder) write4(code byte, n uint32) error {
-	e.buf = e.buf[:5]
-	e.buf[0] = code
-	e.buf[1] = byte(n >> 24)
-	e.buf[2] = byte(n >> 16)
-	e.buf[3] = byte(n >> 8)
-	e.buf[4] = byte(n)
+	e.buf = append4(e.buf[:0], code, n)
 	return e.write(e.buf)
 }
 
 func (e *Encoder) write8(code byte, n uint64) error {
-	e.buf = e.buf[:9]
-	e.buf[0] = code
-	e.buf[1] = byte(n >> 56)
-	e.buf[2] = byte(n >> 48)
-	e.buf[3] = byte(n >> 40)
-	e.buf[4] = byte(n >> 32)
-	e.buf[5] = byte(n >> 24)
-	e.buf[6] = byte(n >> 16)
-	e.buf[7] = byte(n >> 8)
-	e.buf[8] = byte(n)
+	e.buf = append8(e.buf[:0], code, n)
 	return e.write(e.buf)
 }
 
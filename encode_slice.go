@@ -65,7 +65,7 @@ func (e *Encoder) encodeStringLen(l int) error {
 }
 
 func (e *Encoder) EncodeString(v string) error {
-	if intern := e.flags&useInternedStringsFlag != 0; intern || len(e.dict) > 0 {
+	if intern := e.flags&useInternedStringsFlag != 0; (intern || len(e.dict) > 0) && e.flags&canonicalFlag == 0 {
 		return e.encodeInternedString(v, intern)
 	}
 	return e.encodeNormalString(v)
@@ -0,0 +1,391 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// streamChunkSize is the number of buffered bytes after which a chunked
+// stream writes its pending elements to the underlying writer.
+const streamChunkSize = 64 << 10
+
+type streamMode int
+
+const (
+	// streamBuffer back-patches the header in a *bytes.Buffer.
+	streamBuffer streamMode = iota
+	// streamSeek back-patches the header in an io.WriteSeeker.
+	streamSeek
+	// streamChunked writes a sequence of containers terminated by an empty one.
+	streamChunked
+	// streamNested back-patches the header in the chunk buffer of a chunked
+	// container that encloses the stream.
+	streamNested
+)
+
+type encStream struct {
+	isMap bool
+	mode  streamMode
+	n     int // number of appended keys and values
+
+	// Back-patching.
+	pos   int64         // position of the placeholder header
+	chunk *bytes.Buffer // buffer holding the placeholder in streamNested mode
+
+	// Chunked framing.
+	sink    writer
+	buf     bytes.Buffer
+	pending int // keys and values in buf
+}
+
+// BeginArray starts an array of unknown length. Elements are added with
+// Append, BeginArray and BeginMap, and the array is finished with End.
+//
+// When the underlying writer is a *bytes.Buffer or an io.WriteSeeker,
+// a placeholder header is written and patched with the final length by
+// End; the buffer must not be read before End returns. Any other writer
+// gets chunked framing: the elements are written as a sequence of arrays
+// of at most about 64KB each, terminated by an empty array. Only the
+// outermost container is chunked: containers nested in it are buffered
+// and written with their length, so every chunk holds regular values.
+// Chunked arrays are decoded with Decoder.DecodeChunked or
+// Decoder.ChunkedArrayIter.
+func (e *Encoder) BeginArray() error {
+	return e.beginStream(false)
+}
+
+// BeginMap starts a map of unknown length. Keys and values are added
+// alternately with Append, BeginArray and BeginMap, and the map is finished
+// with End. It uses the same framing as BeginArray.
+func (e *Encoder) BeginMap() error {
+	return e.beginStream(true)
+}
+
+// Append encodes v as the next element of the array or map started with
+// BeginArray or BeginMap.
+func (e *Encoder) Append(v interface{}) error {
+	s := e.topStream()
+	if s == nil {
+		return errors.New("msgpack: Append called without BeginArray or BeginMap")
+	}
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	return e.streamItemDone(s)
+}
+
+// End finishes the array or map started with the last BeginArray or BeginMap.
+func (e *Encoder) End() error {
+	s := e.topStream()
+	if s == nil {
+		return errors.New("msgpack: End called without BeginArray or BeginMap")
+	}
+	if s.isMap && s.n%2 != 0 {
+		return errors.New("msgpack: map stream has a key without a value")
+	}
+
+	var err error
+	switch s.mode {
+	case streamBuffer, streamSeek, streamNested:
+		err = e.patchStreamHeader(s)
+	case streamChunked:
+		err = e.flushStreamChunk(s)
+		if err == nil {
+			err = e.writeStreamHeader(s.sink, s.isMap, 0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	e.streams = e.streams[:len(e.streams)-1]
+	if s.mode == streamChunked {
+		e.w = s.sink
+	}
+	if parent := e.topStream(); parent != nil {
+		return e.streamItemDone(parent)
+	}
+	return nil
+}
+
+func (e *Encoder) topStream() *encStream {
+	if len(e.streams) == 0 {
+		return nil
+	}
+	return e.streams[len(e.streams)-1]
+}
+
+func (e *Encoder) beginStream(isMap bool) error {
+	s := &encStream{
+		isMap: isMap,
+	}
+
+	if parent := e.topStream(); parent != nil {
+		s.mode = parent.mode
+		switch parent.mode {
+		case streamChunked:
+			// A chunk must only hold complete values, so the container
+			// is written to the chunk buffer and patched there.
+			s.mode = streamNested
+			s.chunk = &parent.buf
+		case streamNested:
+			s.chunk = parent.chunk
+		}
+	} else {
+		s.mode = e.streamMode()
+		s.sink = e.w
+	}
+
+	switch s.mode {
+	case streamNested:
+		s.pos = int64(s.chunk.Len())
+		if err := e.writeStreamPlaceholder(isMap); err != nil {
+			return err
+		}
+	case streamBuffer, streamSeek:
+		pos, err := e.streamOffset(s.mode)
+		if err != nil {
+			return err
+		}
+		s.pos = pos
+		if err := e.writeStreamPlaceholder(isMap); err != nil {
+			return err
+		}
+	case streamChunked:
+		e.w = &s.buf
+	}
+
+	e.streams = append(e.streams, s)
+	return nil
+}
+
+// streamItemDone is called after a key or value was written to s.
+func (e *Encoder) streamItemDone(s *encStream) error {
+	s.n++
+	if s.mode != streamChunked {
+		return nil
+	}
+
+	s.pending++
+	if s.buf.Len() >= streamChunkSize && (!s.isMap || s.pending%2 == 0) {
+		return e.flushStreamChunk(s)
+	}
+	return nil
+}
+
+// streamMode returns the framing used for a top-level stream.
+func (e *Encoder) streamMode() streamMode {
+	var w io.Writer = e.out
+	if bw, ok := w.(byteWriter); ok {
+		w = bw.Writer
+	}
+
+	switch w := w.(type) {
+	case *bytes.Buffer:
+		return streamBuffer
+	case io.WriteSeeker:
+		// Pipes and terminals implement Seek, but always fail.
+		if _, err := w.Seek(0, io.SeekCurrent); err == nil {
+			return streamSeek
+		}
+	}
+	return streamChunked
+}
+
+func (e *Encoder) sinkWriter() io.Writer {
+	if bw, ok := e.out.(byteWriter); ok {
+		return bw.Writer
+	}
+	return e.out
+}
+
+// streamOffset returns the offset at which the next byte will be written.
+func (e *Encoder) streamOffset(mode streamMode) (int64, error) {
+	var buffered int64
+	if e.flags&bufferedWritesFlag != 0 {
+		buffered = int64(e.bw.Buffered())
+	}
+
+	if mode == streamBuffer {
+		return int64(e.sinkWriter().(*bytes.Buffer).Len()) + buffered, nil
+	}
+	pos, err := e.sinkWriter().(io.Seeker).Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	return pos + buffered, nil
+}
+
+func (e *Encoder) writeStreamPlaceholder(isMap bool) error {
+	c := msgpcode.Array32
+	if isMap {
+		c = msgpcode.Map32
+	}
+	return e.write4(c, 0)
+}
+
+func (e *Encoder) patchStreamHeader(s *encStream) error {
+	n := s.n
+	if s.isMap {
+		n /= 2
+	}
+	if uint64(n) > math.MaxUint32 {
+		return errors.Errorf("msgpack: stream length %d exceeds the maximum length", n)
+	}
+
+	c := msgpcode.Array32
+	if s.isMap {
+		c = msgpcode.Map32
+	}
+	header := append4(e.buf[:0], c, uint32(n))
+
+	if s.mode == streamNested {
+		copy(s.chunk.Bytes()[s.pos:], header)
+		return nil
+	}
+
+	if err := e.Flush(); err != nil {
+		return err
+	}
+
+	if s.mode == streamBuffer {
+		copy(e.sinkWriter().(*bytes.Buffer).Bytes()[s.pos:], header)
+		return nil
+	}
+
+	ws := e.sinkWriter().(io.WriteSeeker)
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(s.pos, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(header); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// flushStreamChunk writes the pending elements of s as one chunk.
+func (e *Encoder) flushStreamChunk(s *encStream) error {
+	if s.pending == 0 {
+		return nil
+	}
+	n := s.pending
+	if s.isMap {
+		n = (n + 1) / 2
+	}
+	if err := e.writeStreamHeader(s.sink, s.isMap, n); err != nil {
+		return err
+	}
+	if _, err := s.sink.Write(s.buf.Bytes()); err != nil {
+		return err
+	}
+	s.buf.Reset()
+	s.pending = 0
+	return nil
+}
+
+func (e *Encoder) writeStreamHeader(w writer, isMap bool, n int) error {
+	old := e.w
+	e.w = w
+	var err error
+	if isMap {
+		err = e.EncodeMapLen(n)
+	} else {
+		err = e.EncodeArrayLen(n)
+	}
+	e.w = old
+	return err
+}
+
+//------------------------------------------------------------------------------
+
+// DecodeChunked decodes an array or map written with chunked framing by
+// Encoder.BeginArray or Encoder.BeginMap into v, which must be a pointer
+// to a slice or a map.
+func (d *Decoder) DecodeChunked(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("msgpack: DecodeChunked(non-pointer %T)", v)
+	}
+	rv = rv.Elem()
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		return d.decodeChunkedSlice(rv)
+	case reflect.Map:
+		return d.decodeChunkedMap(rv)
+	}
+	return errors.Errorf("msgpack: DecodeChunked(unsupported %T)", v)
+}
+
+func (d *Decoder) decodeChunkedSlice(v reflect.Value) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+	for total := 0; ; {
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return nil
+		}
+		// The limit applies to all chunks together.
+		total += n
+		if err := d.checkArrayLen(total); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			if err := d.DecodeValue(v.Index(v.Len() - 1)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (d *Decoder) decodeChunkedMap(v reflect.Value) error {
+	typ := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(typ))
+	}
+	for total := 0; ; {
+		n, err := d.DecodeMapLen()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return nil
+		}
+		// The limit applies to all chunks together.
+		total += n
+		if err := d.checkMapLen(total); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			mk := reflect.New(typ.Key()).Elem()
+			if err := d.DecodeValue(mk); err != nil {
+				return err
+			}
+			mv := reflect.New(typ.Elem()).Elem()
+			if err := d.DecodeValue(mv); err != nil {
+				return err
+			}
+			v.SetMapIndex(mk, mv)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// writeOnly hides the methods of bytes.Buffer so the encoder can't patch it.
+type writeOnly struct {
+	io.Writer
+}
+
+func encodeStream(enc *msgpack.Encoder, rows int) error {
+	if err := enc.BeginMap(); err != nil {
+		return err
+	}
+	if err := enc.Append("rows"); err != nil {
+		return err
+	}
+	if err := enc.BeginArray(); err != nil {
+		return err
+	}
+	for i := 0; i < rows; i++ {
+		row := streamRow{ID: i, Name: strings.Repeat("x", i%100)}
+		if err := enc.Append(row); err != nil {
+			return err
+		}
+	}
+	if err := enc.End(); err != nil {
+		return err
+	}
+	if err := enc.Append("count"); err != nil {
+		return err
+	}
+	if err := enc.Append(rows); err != nil {
+		return err
+	}
+	return enc.End()
+}
+
+type streamRow struct {
+	ID   int    `msgpack:"id"`
+	Name string `msgpack:"name"`
+}
+
+func checkStreamRows(t *testing.T, rows []streamRow, n int) {
+	require.Len(t, rows, n)
+	for i, row := range rows {
+		require.Equal(t, i, row.ID)
+		require.Equal(t, strings.Repeat("x", i%100), row.Name)
+	}
+}
+
+func TestStreamPatched(t *testing.T) {
+	type doc struct {
+		Rows  []streamRow `msgpack:"rows"`
+		Count int         `msgpack:"count"`
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	require.Nil(t, enc.UseBufferedWrites(true))
+	require.Nil(t, encodeStream(enc, 1000))
+	require.Nil(t, enc.Flush())
+
+	var got doc
+	require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, 1000, got.Count)
+	checkStreamRows(t, got.Rows, 1000)
+
+	f, err := ioutil.TempFile("", "msgpack")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.Write([]byte("header"))
+	require.Nil(t, err)
+	enc = msgpack.NewEncoder(f)
+	require.Nil(t, encodeStream(enc, 1000))
+
+	b, err := ioutil.ReadFile(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, "header", string(b[:6]))
+	got = doc{}
+	require.Nil(t, msgpack.Unmarshal(b[6:], &got))
+	require.Equal(t, 1000, got.Count)
+	checkStreamRows(t, got.Rows, 1000)
+}
+
+func TestStreamChunked(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(writeOnly{&buf})
+	require.Nil(t, encodeStream(enc, 5000))
+
+	var doc map[string]msgpack.RawMessage
+	require.Nil(t, msgpack.NewDecoder(&buf).DecodeChunked(&doc))
+	var rows []streamRow
+	require.Nil(t, msgpack.Unmarshal(doc["rows"], &rows))
+	checkStreamRows(t, rows, 5000)
+	var count int
+	require.Nil(t, msgpack.Unmarshal(doc["count"], &count))
+	require.Equal(t, 5000, count)
+	require.Equal(t, 0, buf.Len())
+
+	// [[1, 2], 3]
+	buf.Reset()
+	enc.Reset(writeOnly{&buf})
+	require.Nil(t, enc.BeginArray())
+	require.Nil(t, enc.BeginArray())
+	require.Nil(t, enc.Append(1))
+	require.Nil(t, enc.Append(2))
+	require.Nil(t, enc.End())
+	require.Nil(t, enc.Append(3))
+	require.Nil(t, enc.End())
+
+	var got []interface{}
+	require.Nil(t, msgpack.NewDecoder(&buf).DecodeChunked(&got))
+	require.Equal(t, []interface{}{[]interface{}{int8(1), int8(2)}, int8(3)}, got)
+	require.Equal(t, 0, buf.Len())
+
+	// [[1, 2], [3]]
+	buf.Reset()
+	enc.Reset(writeOnly{&buf})
+	require.Nil(t, enc.BeginArray())
+	for _, row := range [][]int{{1, 2}, {3}} {
+		require.Nil(t, enc.BeginArray())
+		for _, n := range row {
+			require.Nil(t, enc.Append(n))
+		}
+		require.Nil(t, enc.End())
+	}
+	require.Nil(t, enc.End())
+
+	var ints [][]int
+	require.Nil(t, msgpack.NewDecoder(&buf).DecodeChunked(&ints))
+	require.Equal(t, [][]int{{1, 2}, {3}}, ints)
+	require.Equal(t, 0, buf.Len())
+
+	// {"a": {"b": [1]}, "c": [[2]]}
+	buf.Reset()
+	enc.Reset(writeOnly{&buf})
+	require.Nil(t, enc.BeginMap())
+	require.Nil(t, enc.Append("a"))
+	require.Nil(t, enc.BeginMap())
+	require.Nil(t, enc.Append("b"))
+	require.Nil(t, enc.BeginArray())
+	require.Nil(t, enc.Append(1))
+	require.Nil(t, enc.End())
+	require.Nil(t, enc.End())
+	require.Nil(t, enc.Append("c"))
+	require.Nil(t, enc.BeginArray())
+	require.Nil(t, enc.Append([]int{2}))
+	require.Nil(t, enc.End())
+	require.Nil(t, enc.End())
+
+	var m map[string]interface{}
+	require.Nil(t, msgpack.NewDecoder(&buf).DecodeChunked(&m))
+	require.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{int8(1)}},
+		"c": []interface{}{[]interface{}{int8(2)}},
+	}, m)
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestStreamErrors(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+
+	require.NotNil(t, enc.End())
+	require.NotNil(t, enc.Append(1))
+
+	require.Nil(t, enc.BeginMap())
+	require.Nil(t, enc.Append("key"))
+	require.NotNil(t, enc.End())
+
+	var v []int
+	require.NotNil(t, msgpack.NewDecoder(&buf).DecodeChunked(v))
+}
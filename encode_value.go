@@ -127,6 +127,11 @@ func ptrEncoderFunc(typ reflect.Type) encoderFunc {
 		if v.IsNil() {
 			return e.EncodeNil()
 		}
+		if e.extRegistry != nil {
+			if fn, ok := e.extRegistry.encoder(typ.Elem()); ok {
+				return fn(e, v.Elem())
+			}
+		}
 		return encoder(e, v.Elem())
 	}
 }
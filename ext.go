@@ -3,6 +3,7 @@ package msgpack
 import (
 	"math"
 	"reflect"
+	"sync"
 
 	"github.com/gostudentorg/msgpack/v5/msgpcode"
 
@@ -14,19 +15,82 @@ type extInfo struct {
 	Decoder func(d *Decoder, v reflect.Value, extLen int) error
 }
 
-var extTypes = make(map[int8]*extInfo)
-
 type MarshalerUnmarshaler interface {
 	Marshaler
 	Unmarshaler
 }
 
+// ExtRegistry maps MessagePack extension ids to Go types. It is safe for
+// concurrent use.
+//
+// A registry is attached to an Encoder or Decoder with SetExtRegistry.
+// Types and ids that are not found in it are looked up in the global registry
+// used by RegisterExt, RegisterExtEncoder and RegisterExtDecoder.
+type ExtRegistry struct {
+	mu sync.RWMutex
+
+	encTypes map[int8]reflect.Type
+	decTypes map[int8]*extInfo
+	encoders map[reflect.Type]encoderFunc
+	decoders map[reflect.Type]decoderFunc
+
+	// global is set for the default registry, which keeps its codecs
+	// in typeEncMap and typeDecMap.
+	global bool
+}
+
+var defaultExtRegistry = newExtRegistry(true)
+
+// NewExtRegistry returns an empty extension registry.
+func NewExtRegistry() *ExtRegistry {
+	return newExtRegistry(false)
+}
+
+func newExtRegistry(global bool) *ExtRegistry {
+	r := &ExtRegistry{
+		encTypes: make(map[int8]reflect.Type),
+		decTypes: make(map[int8]*extInfo),
+		global:   global,
+	}
+	if !global {
+		r.encoders = make(map[reflect.Type]encoderFunc)
+		r.decoders = make(map[reflect.Type]decoderFunc)
+	}
+	return r
+}
+
 func RegisterExt(extID int8, value MarshalerUnmarshaler) {
-	RegisterExtEncoder(extID, value, func(e *Encoder, v reflect.Value) ([]byte, error) {
+	defaultExtRegistry.RegisterExt(extID, value)
+}
+
+func UnregisterExt(extID int8) {
+	defaultExtRegistry.UnregisterExt(extID)
+}
+
+func RegisterExtEncoder(
+	extID int8,
+	value interface{},
+	encoder func(enc *Encoder, v reflect.Value) ([]byte, error),
+) {
+	defaultExtRegistry.RegisterExtEncoder(extID, value, encoder)
+}
+
+func RegisterExtDecoder(
+	extID int8,
+	value interface{},
+	decoder func(dec *Decoder, v reflect.Value, extLen int) error,
+) {
+	defaultExtRegistry.RegisterExtDecoder(extID, value, decoder)
+}
+
+// RegisterExt registers value as the Go type of extension extID using
+// its MarshalMsgpack and UnmarshalMsgpack methods.
+func (r *ExtRegistry) RegisterExt(extID int8, value MarshalerUnmarshaler) {
+	r.RegisterExtEncoder(extID, value, func(e *Encoder, v reflect.Value) ([]byte, error) {
 		marshaler := v.Interface().(Marshaler)
 		return marshaler.MarshalMsgpack()
 	})
-	RegisterExtDecoder(extID, value, func(d *Decoder, v reflect.Value, extLen int) error {
+	r.RegisterExtDecoder(extID, value, func(d *Decoder, v reflect.Value, extLen int) error {
 		b, err := d.readN(extLen)
 		if err != nil {
 			return err
@@ -35,40 +99,148 @@ func RegisterExt(extID int8, value MarshalerUnmarshaler) {
 	})
 }
 
-func UnregisterExt(extID int8) {
-	unregisterExtEncoder(extID)
-	unregisterExtDecoder(extID)
+// UnregisterExt removes the encoder and decoder of extension extID.
+func (r *ExtRegistry) UnregisterExt(extID int8) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unregisterExtEncoder(extID)
+	r.unregisterExtDecoder(extID)
 }
 
-func RegisterExtEncoder(
+// RegisterExtEncoder registers encoder to encode values of value's type
+// as extension extID.
+func (r *ExtRegistry) RegisterExtEncoder(
 	extID int8,
 	value interface{},
 	encoder func(enc *Encoder, v reflect.Value) ([]byte, error),
 ) {
-	unregisterExtEncoder(extID)
-
 	typ := reflect.TypeOf(value)
 	extEncoder := makeExtEncoder(extID, typ, encoder)
-	typeEncMap.Store(extID, typ)
-	typeEncMap.Store(typ, extEncoder)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unregisterExtEncoder(extID)
+	r.encTypes[extID] = typ
+	r.storeEncoder(typ, extEncoder)
+	if typ.Kind() == reflect.Ptr {
+		r.storeEncoder(typ.Elem(), makeExtEncoderAddr(extEncoder))
+	}
+}
+
+// RegisterExtDecoder registers decoder to decode extension extID
+// into values of value's type.
+func (r *ExtRegistry) RegisterExtDecoder(
+	extID int8,
+	value interface{},
+	decoder func(dec *Decoder, v reflect.Value, extLen int) error,
+) {
+	typ := reflect.TypeOf(value)
+	extDecoder := makeExtDecoder(extID, typ, decoder)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unregisterExtDecoder(extID)
+	r.decTypes[extID] = &extInfo{
+		Type:    typ,
+		Decoder: decoder,
+	}
+	r.storeDecoder(typ, extDecoder)
 	if typ.Kind() == reflect.Ptr {
-		typeEncMap.Store(typ.Elem(), makeExtEncoderAddr(extEncoder))
+		r.storeDecoder(typ.Elem(), makeExtDecoderAddr(extDecoder))
 	}
 }
 
-func unregisterExtEncoder(extID int8) {
-	t, ok := typeEncMap.Load(extID)
+func (r *ExtRegistry) unregisterExtEncoder(extID int8) {
+	typ, ok := r.encTypes[extID]
 	if !ok {
 		return
 	}
-	typeEncMap.Delete(extID)
-	typ := t.(reflect.Type)
-	typeEncMap.Delete(typ)
+	delete(r.encTypes, extID)
+	r.deleteEncoder(typ)
 	if typ.Kind() == reflect.Ptr {
-		typeEncMap.Delete(typ.Elem())
+		r.deleteEncoder(typ.Elem())
 	}
 }
 
+func (r *ExtRegistry) unregisterExtDecoder(extID int8) {
+	info, ok := r.decTypes[extID]
+	if !ok {
+		return
+	}
+	delete(r.decTypes, extID)
+	r.deleteDecoder(info.Type)
+	if info.Type.Kind() == reflect.Ptr {
+		r.deleteDecoder(info.Type.Elem())
+	}
+}
+
+func (r *ExtRegistry) storeEncoder(typ reflect.Type, fn encoderFunc) {
+	if r.global {
+		typeEncMap.Store(typ, fn)
+		return
+	}
+	r.encoders[typ] = fn
+}
+
+func (r *ExtRegistry) deleteEncoder(typ reflect.Type) {
+	if r.global {
+		typeEncMap.Delete(typ)
+		return
+	}
+	delete(r.encoders, typ)
+}
+
+func (r *ExtRegistry) storeDecoder(typ reflect.Type, fn decoderFunc) {
+	if r.global {
+		typeDecMap.Store(typ, fn)
+		return
+	}
+	r.decoders[typ] = fn
+}
+
+func (r *ExtRegistry) deleteDecoder(typ reflect.Type) {
+	if r.global {
+		typeDecMap.Delete(typ)
+		return
+	}
+	delete(r.decoders, typ)
+}
+
+// encoder returns the ext encoder registered for typ.
+// It always fails for the global registry.
+func (r *ExtRegistry) encoder(typ reflect.Type) (encoderFunc, bool) {
+	r.mu.RLock()
+	fn, ok := r.encoders[typ]
+	r.mu.RUnlock()
+	return fn, ok
+}
+
+// decoder returns the ext decoder registered for typ.
+// It always fails for the global registry.
+func (r *ExtRegistry) decoder(typ reflect.Type) (decoderFunc, bool) {
+	r.mu.RLock()
+	fn, ok := r.decoders[typ]
+	r.mu.RUnlock()
+	return fn, ok
+}
+
+func (r *ExtRegistry) extInfo(extID int8) (*extInfo, bool) {
+	r.mu.RLock()
+	info, ok := r.decTypes[extID]
+	r.mu.RUnlock()
+	return info, ok
+}
+
+// setExtInfo registers a decoder used only when decoding into interface{}.
+func (r *ExtRegistry) setExtInfo(extID int8, info *extInfo) {
+	r.mu.Lock()
+	r.decTypes[extID] = info
+	r.mu.Unlock()
+}
+
 func makeExtEncoder(
 	extID int8,
 	typ reflect.Type,
@@ -103,41 +275,6 @@ func makeExtEncoderAddr(extEncoder encoderFunc) encoderFunc {
 	}
 }
 
-func RegisterExtDecoder(
-	extID int8,
-	value interface{},
-	decoder func(dec *Decoder, v reflect.Value, extLen int) error,
-) {
-	unregisterExtDecoder(extID)
-
-	typ := reflect.TypeOf(value)
-	extDecoder := makeExtDecoder(extID, typ, decoder)
-	extTypes[extID] = &extInfo{
-		Type:    typ,
-		Decoder: decoder,
-	}
-
-	typeDecMap.Store(extID, typ)
-	typeDecMap.Store(typ, extDecoder)
-	if typ.Kind() == reflect.Ptr {
-		typeDecMap.Store(typ.Elem(), makeExtDecoderAddr(extDecoder))
-	}
-}
-
-func unregisterExtDecoder(extID int8) {
-	t, ok := typeDecMap.Load(extID)
-	if !ok {
-		return
-	}
-	typeDecMap.Delete(extID)
-	delete(extTypes, extID)
-	typ := t.(reflect.Type)
-	typeDecMap.Delete(typ)
-	if typ.Kind() == reflect.Ptr {
-		typeDecMap.Delete(typ.Elem())
-	}
-}
-
 func makeExtDecoder(
 	wantedExtID int8,
 	typ reflect.Type,
@@ -177,25 +314,30 @@ func (e *Encoder) EncodeExtHeader(extID int8, extLen int) error {
 }
 
 func (e *Encoder) encodeExtLen(l int) error {
+	e.buf = appendExtLen(e.buf[:0], l)
+	return e.write(e.buf)
+}
+
+func appendExtLen(b []byte, l int) []byte {
 	switch l {
 	case 1:
-		return e.writeCode(msgpcode.FixExt1)
+		return append(b, msgpcode.FixExt1)
 	case 2:
-		return e.writeCode(msgpcode.FixExt2)
+		return append(b, msgpcode.FixExt2)
 	case 4:
-		return e.writeCode(msgpcode.FixExt4)
+		return append(b, msgpcode.FixExt4)
 	case 8:
-		return e.writeCode(msgpcode.FixExt8)
+		return append(b, msgpcode.FixExt8)
 	case 16:
-		return e.writeCode(msgpcode.FixExt16)
+		return append(b, msgpcode.FixExt16)
 	}
 	if l <= math.MaxUint8 {
-		return e.write1(msgpcode.Ext8, uint8(l))
+		return append1(b, msgpcode.Ext8, uint8(l))
 	}
 	if l <= math.MaxUint16 {
-		return e.write2(msgpcode.Ext16, uint16(l))
+		return append2(b, msgpcode.Ext16, uint16(l))
 	}
-	return e.write4(msgpcode.Ext32, uint32(l))
+	return append4(b, msgpcode.Ext32, uint32(l))
 }
 
 func (d *Decoder) DecodeExtHeader() (extID int8, extLen int, err error) {
@@ -211,8 +353,11 @@ func (d *Decoder) extHeader(c byte) (int8, int, error) {
 	if err != nil {
 		return 0, 0, err
 	}
+	if err := d.checkExtLen(extLen); err != nil {
+		return 0, 0, err
+	}
 
-	extID, err := d.readCode()
+	extID, err := d.readByte()
 	if err != nil {
 		return 0, 0, err
 	}
@@ -252,8 +397,15 @@ func (d *Decoder) decodeInterfaceExt(c byte) (interface{}, error) {
 		return nil, err
 	}
 
-	info, ok := extTypes[extID]
+	info, ok := d.extInfo(extID)
 	if !ok {
+		if d.flags&rawExtFlag != 0 {
+			ext := new(RawExt)
+			if err := d.decodeRawExt(ext, extID, extLen); err != nil {
+				return nil, err
+			}
+			return ext, nil
+		}
 		return nil, errors.Errorf("msgpack: unknown ext id=%d", extID)
 	}
 
@@ -269,23 +421,47 @@ func (d *Decoder) decodeInterfaceExt(c byte) (interface{}, error) {
 	return v.Interface(), nil
 }
 
+func (d *Decoder) decodeRawExt(ext *RawExt, extID int8, extLen int) error {
+	b, err := d.readN(extLen)
+	if err != nil {
+		return err
+	}
+	ext.Type = extID
+	ext.Data = make([]byte, len(b))
+	copy(ext.Data, b)
+	return nil
+}
+
+// extInfo looks up extID in the decoder's registry and then in the global one.
+func (d *Decoder) extInfo(extID int8) (*extInfo, bool) {
+	if d.extRegistry != nil {
+		if info, ok := d.extRegistry.extInfo(extID); ok {
+			return info, true
+		}
+	}
+	return defaultExtRegistry.extInfo(extID)
+}
+
 func (d *Decoder) skipExt(c byte) error {
 	n, err := d.parseExtLen(c)
 	if err != nil {
 		return err
 	}
+	if err := d.checkExtLen(n); err != nil {
+		return err
+	}
 	return d.skipN(n + 1)
 }
 
 func (d *Decoder) skipExtHeader(c byte) error {
 	// Read ext type.
-	_, err := d.readCode()
+	_, err := d.readByte()
 	if err != nil {
 		return err
 	}
 	// Read ext body len.
 	for i := 0; i < extHeaderLen(c); i++ {
-		_, err := d.readCode()
+		_, err := d.readByte()
 		if err != nil {
 			return err
 		}
@@ -3,6 +3,7 @@ package msgpack_test
 import (
 	"bytes"
 	"encoding/hex"
+	"reflect"
 	"testing"
 	"time"
 
@@ -171,3 +172,139 @@ func TestDecodeCustomPayload(t *testing.T) {
 		t.Fatalf("got %q, wanted %q", payload, wanted)
 	}
 }
+
+type registryPoint struct {
+	X, Y int8
+}
+
+type registryColor struct {
+	Name string
+}
+
+func TestExtRegistry(t *testing.T) {
+	points := msgpack.NewExtRegistry()
+	points.RegisterExtEncoder(1, registryPoint{}, func(e *msgpack.Encoder, v reflect.Value) ([]byte, error) {
+		p := v.Interface().(registryPoint)
+		return []byte{byte(p.X), byte(p.Y)}, nil
+	})
+	points.RegisterExtDecoder(1, registryPoint{}, func(d *msgpack.Decoder, v reflect.Value, extLen int) error {
+		x, err := d.DecodeInt8()
+		if err != nil {
+			return err
+		}
+		y, err := d.DecodeInt8()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(registryPoint{X: x, Y: y}))
+		return nil
+	})
+
+	colors := msgpack.NewExtRegistry()
+	colors.RegisterExt(1, (*registryColor)(nil))
+
+	type Shape struct {
+		Center registryPoint
+		Points []registryPoint
+		Ptr    *registryPoint
+		Ext    *ExtTest
+	}
+
+	in := Shape{
+		Center: registryPoint{X: 1, Y: 2},
+		Points: []registryPoint{{X: 3, Y: 4}},
+		Ptr:    &registryPoint{X: 5, Y: 6},
+		Ext:    &ExtTest{S: "world"},
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetExtRegistry(points)
+	require.Nil(t, enc.Encode(in))
+	// Fields, slice elements and pointers all use the registry.
+	require.Contains(t, hex.EncodeToString(buf.Bytes()), "d5010102")
+	require.Contains(t, hex.EncodeToString(buf.Bytes()), "d5010304")
+	require.Contains(t, hex.EncodeToString(buf.Bytes()), "d5010506")
+
+	b := buf.Bytes()
+	var noRegistry Shape
+	require.NotNil(t, msgpack.Unmarshal(b, &noRegistry))
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetExtRegistry(points)
+	var out Shape
+	require.Nil(t, dec.Decode(&out))
+	require.Equal(t, in.Center, out.Center)
+	require.Equal(t, in.Points, out.Points)
+	require.Equal(t, in.Ptr, out.Ptr)
+	require.Equal(t, "hello world", out.Ext.S)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetExtRegistry(points)
+	var iface map[string]interface{}
+	require.Nil(t, dec.Decode(&iface))
+	require.Equal(t, registryPoint{X: 1, Y: 2}, iface["Center"])
+
+	// The same ext id means something else in another registry.
+	b, err := msgpack.Marshal(registryPoint{X: 1, Y: 2})
+	require.Nil(t, err)
+	require.Equal(t, "82a158d001a159d002", hex.EncodeToString(b))
+
+	buf.Reset()
+	enc = msgpack.NewEncoder(&buf)
+	enc.SetExtRegistry(colors)
+	require.Nil(t, enc.Encode(&registryColor{Name: "red"}))
+
+	dec = msgpack.NewDecoder(&buf)
+	dec.SetExtRegistry(colors)
+	v, err := dec.DecodeInterface()
+	require.Nil(t, err)
+	require.Equal(t, &registryColor{Name: "red"}, v)
+
+	// Without the ext the global Marshaler encoding is used.
+	colors.UnregisterExt(1)
+	buf.Reset()
+	require.Nil(t, enc.Encode(&registryColor{Name: "red"}))
+	require.Equal(t, "726564", hex.EncodeToString(buf.Bytes()))
+}
+
+func (c *registryColor) MarshalMsgpack() ([]byte, error) {
+	return []byte(c.Name), nil
+}
+
+func (c *registryColor) UnmarshalMsgpack(b []byte) error {
+	c.Name = string(b)
+	return nil
+}
+
+func TestRawExt(t *testing.T) {
+	in := map[string]interface{}{
+		"name":    "proxy",
+		"unknown": msgpack.RawExt{Type: 42, Data: []byte{1, 2, 3}},
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	require.Nil(t, enc.Encode(in))
+	b := append([]byte(nil), buf.Bytes()...)
+
+	var out map[string]interface{}
+	err := msgpack.Unmarshal(b, &out)
+	require.NotNil(t, err)
+	require.Equal(t, "msgpack: unknown ext id=42 (path=unknown offset=23)", err.Error())
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.UseRawExt(true)
+	require.Nil(t, dec.Decode(&out))
+	require.Equal(t, &msgpack.RawExt{Type: 42, Data: []byte{1, 2, 3}}, out["unknown"])
+	require.Equal(t, "proxy", out["name"])
+
+	buf.Reset()
+	require.Nil(t, enc.Encode(out))
+	require.Equal(t, b, buf.Bytes())
+
+	var ext msgpack.RawExt
+	require.Nil(t, msgpack.Unmarshal(b[len(b)-6:], &ext))
+	require.Equal(t, msgpack.RawExt{Type: 42, Data: []byte{1, 2, 3}}, ext)
+}
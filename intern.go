@@ -16,10 +16,10 @@ const (
 var internedStringExtID = int8(math.MinInt8)
 
 func init() {
-	extTypes[internedStringExtID] = &extInfo{
+	defaultExtRegistry.setExtInfo(internedStringExtID, &extInfo{
 		Type:    stringType,
 		Decoder: decodeInternedStringExt,
-	}
+	})
 }
 
 func decodeInternedStringExt(d *Decoder, v reflect.Value, extLen int) error {
@@ -39,6 +39,17 @@ func decodeInternedStringExt(d *Decoder, v reflect.Value, extLen int) error {
 
 // ------------------------------------------------------------------------------
 
+// EncodeInternedString encodes s like a struct field with the intern tag.
+func (e *Encoder) EncodeInternedString(s string) error {
+	return e.encodeInternedString(s, true)
+}
+
+// EncodeInternedInterface encodes v like an interface{} struct field
+// with the intern tag.
+func (e *Encoder) EncodeInternedInterface(v interface{}) error {
+	return encodeInternedInterfaceValue(e, reflect.ValueOf(&v).Elem())
+}
+
 func encodeInternedInterfaceValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
@@ -56,6 +67,9 @@ func encodeInternedStringValue(e *Encoder, v reflect.Value) error {
 }
 
 func (e *Encoder) encodeInternedString(s string, intern bool) error {
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeNormalString(s)
+	}
 	// Interned string takes at least 3 bytes. Plain string 1 byte + string len.
 	if len(s) >= minInternedStringLen {
 		if idx, ok := e.dict[s]; ok {
@@ -101,6 +115,19 @@ func (e *Encoder) encodeInternedStringIndex(idx int) error {
 
 // ------------------------------------------------------------------------------
 
+// DecodeInternedString decodes a string like a struct field with the intern tag.
+func (d *Decoder) DecodeInternedString() (string, error) {
+	return d.decodeInternedString(true)
+}
+
+// DecodeInternedInterface decodes a value like an interface{} struct field
+// with the intern tag.
+func (d *Decoder) DecodeInternedInterface() (interface{}, error) {
+	var v interface{}
+	err := decodeInternedInterfaceValue(d, reflect.ValueOf(&v).Elem())
+	return v, err
+}
+
 func decodeInternedInterfaceValue(d *Decoder, v reflect.Value) error {
 	s, err := d.decodeInternedString(true)
 	if err == nil {
@@ -113,7 +140,7 @@ func decodeInternedInterfaceValue(d *Decoder, v reflect.Value) error {
 		}
 	}
 
-	if err := d.s.UnreadByte(); err != nil {
+	if err := d.unreadByte(); err != nil {
 		return err
 	}
 	return decodeInterfaceValue(d, v)
@@ -0,0 +1,160 @@
+package jsonx
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// FromJSON transcodes a sequence of JSON values from src to MessagePack in
+// dst. Integral numbers are written as integers in the shortest form and
+// other numbers as float64. Every top-level value is buffered until it is
+// complete, because MessagePack needs the length of arrays and maps before
+// their elements.
+//
+// FromJSON ignores the Options: it doesn't reverse the Bin, Ext, Time and
+// NaN formats, because their output can't be told apart from ordinary JSON
+// strings, numbers and objects. The method exists for symmetry with ToJSON.
+func (o Options) FromJSON(dst io.Writer, src io.Reader) error {
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	t := &fromJSON{dec: dec}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.value(tok, 0); err != nil {
+			return err
+		}
+		if _, err := dst.Write(t.flush()); err != nil {
+			return err
+		}
+	}
+}
+
+type fromJSON struct {
+	dec  *json.Decoder
+	buf  []byte // elements without container headers
+	hdrs []containerHeader
+	out  []byte
+}
+
+// containerHeader is the header of a container that goes in front of buf[pos:].
+type containerHeader struct {
+	pos   int
+	n     int
+	isMap bool
+}
+
+// flush returns the buffered value with the container headers inserted in
+// a single pass and resets the buffers.
+func (t *fromJSON) flush() []byte {
+	out := t.out[:0]
+	pos := 0
+	for _, h := range t.hdrs {
+		out = append(out, t.buf[pos:h.pos]...)
+		pos = h.pos
+		if h.isMap {
+			out = msgpack.AppendMapLen(out, h.n)
+		} else {
+			out = msgpack.AppendArrayLen(out, h.n)
+		}
+	}
+	out = append(out, t.buf[pos:]...)
+
+	t.out = out
+	t.buf = t.buf[:0]
+	t.hdrs = t.hdrs[:0]
+	return out
+}
+
+func (t *fromJSON) value(tok json.Token, depth int) error {
+	switch tok := tok.(type) {
+	case nil:
+		t.buf = msgpack.AppendNil(t.buf)
+	case bool:
+		t.buf = msgpack.AppendBool(t.buf, tok)
+	case string:
+		t.buf = msgpack.AppendString(t.buf, tok)
+	case json.Number:
+		return t.number(tok)
+	case json.Delim:
+		switch tok {
+		case '[':
+			return t.container(false, depth)
+		case '{':
+			return t.container(true, depth)
+		}
+		return errors.Errorf("jsonx: unexpected %q", tok)
+	default:
+		return errors.Errorf("jsonx: unexpected JSON token %T", tok)
+	}
+	return nil
+}
+
+func (t *fromJSON) number(num json.Number) error {
+	s := string(num)
+	if !strings.ContainsAny(s, ".eE") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			t.buf = msgpack.AppendInt(t.buf, n)
+			return nil
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			t.buf = msgpack.AppendUint(t.buf, n)
+			return nil
+		}
+		// Out of the integer range: fall back to float64.
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.Errorf("jsonx: invalid number %s", s)
+	}
+	t.buf = msgpack.AppendFloat64(t.buf, f)
+	return nil
+}
+
+// container writes the elements of an array or an object and records the
+// header to insert in front of them once their number is known. Headers are
+// inserted by flush, so nested containers don't move the buffered elements.
+func (t *fromJSON) container(isMap bool, depth int) error {
+	if depth >= maxDepth {
+		return errors.Errorf("jsonx: exceeded max depth of %d", maxDepth)
+	}
+
+	hdr := len(t.hdrs)
+	t.hdrs = append(t.hdrs, containerHeader{pos: len(t.buf), isMap: isMap})
+	n := 0
+	for t.dec.More() {
+		tok, err := t.dec.Token()
+		if err != nil {
+			return err
+		}
+		if isMap {
+			// Token guarantees that object keys are strings.
+			t.buf = msgpack.AppendString(t.buf, tok.(string))
+			if tok, err = t.dec.Token(); err != nil {
+				return err
+			}
+		}
+		if err := t.value(tok, depth+1); err != nil {
+			return err
+		}
+		n++
+	}
+	// The closing delimiter.
+	if _, err := t.dec.Token(); err != nil {
+		return err
+	}
+
+	t.hdrs[hdr].n = n
+	return nil
+}
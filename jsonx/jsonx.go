@@ -0,0 +1,591 @@
+// Package jsonx transcodes between MessagePack and JSON without decoding
+// into intermediate Go values.
+//
+// ToJSON walks the MessagePack input code by code and writes the matching
+// JSON tokens; FromJSON walks the JSON tokens and writes the matching
+// MessagePack codes. Integers keep their exact value in both directions.
+package jsonx
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+const (
+	timeExtID           = 13
+	timeExtID2          = -1
+	internedStringExtID = math.MinInt8
+)
+
+// maxDepth limits the nesting of arrays and maps, so that hostile input
+// can't exhaust the stack.
+const maxDepth = 10000
+
+// BinFormat selects how MessagePack binary data is written to JSON.
+type BinFormat int
+
+const (
+	// BinBase64 writes binary data as a standard base64 string.
+	BinBase64 BinFormat = iota
+	// BinHex writes binary data as a hex string.
+	BinHex
+	// BinArray writes binary data as an array of numbers.
+	BinArray
+)
+
+// ExtFormat selects how MessagePack extensions are written to JSON.
+type ExtFormat int
+
+const (
+	// ExtObject writes an extension as {"type":id,"data":data} with the
+	// data formatted according to Options.Bin.
+	ExtObject ExtFormat = iota
+	// ExtNull writes an extension as null.
+	ExtNull
+	// ExtError makes ToJSON fail on extensions.
+	ExtError
+)
+
+// TimeFormat selects how the time extensions (ids 13 and -1) are written
+// to JSON.
+type TimeFormat int
+
+const (
+	// TimeRFC3339 writes time as an RFC 3339 string in UTC with nanoseconds.
+	TimeRFC3339 TimeFormat = iota
+	// TimeUnixMillis writes time as the number of milliseconds since the
+	// Unix epoch.
+	TimeUnixMillis
+	// TimeExt handles the time extensions like any other extension.
+	TimeExt
+)
+
+// KeyFormat selects how map keys that are not strings are written to JSON.
+type KeyFormat int
+
+const (
+	// KeyString formats numbers, booleans, nil and binary data keys as
+	// JSON strings.
+	KeyString KeyFormat = iota
+	// KeyError makes ToJSON fail on keys that are not strings.
+	KeyError
+)
+
+// NaNFormat selects how NaN and infinite floats are written to JSON.
+type NaNFormat int
+
+const (
+	// NaNError makes ToJSON fail on NaN and infinite floats.
+	NaNError NaNFormat = iota
+	// NaNNull writes NaN and infinite floats as null.
+	NaNNull
+	// NaNString writes NaN and infinite floats as "NaN", "+Inf" or "-Inf".
+	NaNString
+)
+
+// Options configures ToJSON; FromJSON ignores them. The zero value is ready
+// to use.
+type Options struct {
+	Bin  BinFormat
+	Ext  ExtFormat
+	Time TimeFormat
+	Keys KeyFormat
+	NaN  NaNFormat
+	// InternedStrings resolves strings interned by
+	// Encoder.UseInternedStrings. Otherwise the interned string extension
+	// is handled like any other extension.
+	InternedStrings bool
+}
+
+// ToJSON transcodes a sequence of MessagePack values from src to JSON in
+// dst using the default Options.
+func ToJSON(dst io.Writer, src io.Reader) error {
+	return Options{}.ToJSON(dst, src)
+}
+
+// FromJSON transcodes a sequence of JSON values from src to MessagePack in
+// dst using the default Options.
+func FromJSON(dst io.Writer, src io.Reader) error {
+	return Options{}.FromJSON(dst, src)
+}
+
+// ToJSON transcodes a sequence of MessagePack values from src to JSON in
+// dst. Every value is followed by a newline, like with json.Encoder.
+func (o Options) ToJSON(dst io.Writer, src io.Reader) error {
+	br := bufio.NewReader(src)
+	dec := msgpack.NewDecoder(br)
+	dec.UseInternedStrings(o.InternedStrings)
+	t := &toJSON{
+		opt: o,
+		br:  br,
+		dec: dec,
+		w:   bufio.NewWriter(dst),
+	}
+
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+		if err := t.value(0); err != nil {
+			return err
+		}
+		if err := t.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return t.w.Flush()
+}
+
+type toJSON struct {
+	opt Options
+	br  *bufio.Reader
+	dec *msgpack.Decoder
+	w   *bufio.Writer
+	buf []byte
+}
+
+// write writes b, which is usually built on top of t.buf, and keeps it for
+// reuse.
+func (t *toJSON) write(b []byte) error {
+	t.buf = b[:0]
+	_, err := t.w.Write(b)
+	return err
+}
+
+//nolint:gocyclo
+func (t *toJSON) value(depth int) error {
+	c, err := t.dec.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c == msgpcode.Nil:
+		if err := t.dec.DecodeNil(); err != nil {
+			return err
+		}
+		_, err := t.w.WriteString("null")
+		return err
+	case msgpcode.IsBool(c):
+		v, err := t.dec.DecodeBool()
+		if err != nil {
+			return err
+		}
+		return t.write(strconv.AppendBool(t.buf[:0], v))
+	case msgpcode.IsFixedNum(c), msgpcode.IsInt(c):
+		n, err := t.dec.DecodeInt64()
+		if err != nil {
+			return err
+		}
+		return t.write(strconv.AppendInt(t.buf[:0], n, 10))
+	case msgpcode.IsUInt(c):
+		n, err := t.dec.DecodeUint64()
+		if err != nil {
+			return err
+		}
+		return t.write(strconv.AppendUint(t.buf[:0], n, 10))
+	case c == msgpcode.Float:
+		f, err := t.dec.DecodeFloat32()
+		if err != nil {
+			return err
+		}
+		return t.float(float64(f), 32)
+	case c == msgpcode.Double:
+		f, err := t.dec.DecodeFloat64()
+		if err != nil {
+			return err
+		}
+		return t.float(f, 64)
+	case msgpcode.IsString(c):
+		s, err := t.dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		return t.write(appendString(t.buf[:0], s))
+	case msgpcode.IsBin(c):
+		b, err := t.dec.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		return t.write(t.appendBin(t.buf[:0], b))
+	case msgpcode.IsArray(c):
+		return t.array(depth)
+	case msgpcode.IsMap(c):
+		return t.object(depth)
+	case msgpcode.IsExt(c):
+		return t.ext()
+	}
+	return errors.Errorf("jsonx: unknown msgpack code %x", c)
+}
+
+func (t *toJSON) float(f float64, bitSize int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		switch t.opt.NaN {
+		case NaNNull:
+			_, err := t.w.WriteString("null")
+			return err
+		case NaNString:
+			return t.write(appendString(t.buf[:0], strconv.FormatFloat(f, 'g', -1, bitSize)))
+		default:
+			return errors.Errorf("jsonx: unsupported float value %v", f)
+		}
+	}
+	return t.write(strconv.AppendFloat(t.buf[:0], f, 'g', -1, bitSize))
+}
+
+func (t *toJSON) appendBin(b, data []byte) []byte {
+	switch t.opt.Bin {
+	case BinHex:
+		b = append(b, '"')
+		b = append(b, hex.EncodeToString(data)...)
+		return append(b, '"')
+	case BinArray:
+		b = append(b, '[')
+		for i, c := range data {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendUint(b, uint64(c), 10)
+		}
+		return append(b, ']')
+	default:
+		b = append(b, '"')
+		n := len(b)
+		b = append(b, make([]byte, base64.StdEncoding.EncodedLen(len(data)))...)
+		base64.StdEncoding.Encode(b[n:], data)
+		return append(b, '"')
+	}
+}
+
+func (t *toJSON) array(depth int) error {
+	if depth >= maxDepth {
+		return errors.Errorf("jsonx: exceeded max depth of %d", maxDepth)
+	}
+	n, err := t.dec.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if err := t.w.WriteByte('['); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := t.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if err := t.value(depth + 1); err != nil {
+			return err
+		}
+	}
+	return t.w.WriteByte(']')
+}
+
+func (t *toJSON) object(depth int) error {
+	if depth >= maxDepth {
+		return errors.Errorf("jsonx: exceeded max depth of %d", maxDepth)
+	}
+	n, err := t.dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if err := t.w.WriteByte('{'); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := t.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if err := t.key(); err != nil {
+			return err
+		}
+		if err := t.w.WriteByte(':'); err != nil {
+			return err
+		}
+		if err := t.value(depth + 1); err != nil {
+			return err
+		}
+	}
+	return t.w.WriteByte('}')
+}
+
+func (t *toJSON) key() error {
+	c, err := t.dec.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	if msgpcode.IsString(c) {
+		s, err := t.dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		return t.write(appendString(t.buf[:0], s))
+	}
+	if msgpcode.IsExt(c) && t.opt.InternedStrings {
+		if id, err := t.extID(c); err == nil && id == internedStringExtID {
+			s, err := t.dec.DecodeString()
+			if err != nil {
+				return err
+			}
+			return t.write(appendString(t.buf[:0], s))
+		}
+	}
+
+	if t.opt.Keys == KeyError {
+		return errors.Errorf("jsonx: unsupported map key code %x", c)
+	}
+
+	// None of the formats below needs escaping.
+	b := append(t.buf[:0], '"')
+	switch {
+	case c == msgpcode.Nil:
+		if err := t.dec.DecodeNil(); err != nil {
+			return err
+		}
+		b = append(b, "null"...)
+	case msgpcode.IsBool(c):
+		v, err := t.dec.DecodeBool()
+		if err != nil {
+			return err
+		}
+		b = strconv.AppendBool(b, v)
+	case msgpcode.IsFixedNum(c), msgpcode.IsInt(c):
+		n, err := t.dec.DecodeInt64()
+		if err != nil {
+			return err
+		}
+		b = strconv.AppendInt(b, n, 10)
+	case msgpcode.IsUInt(c):
+		n, err := t.dec.DecodeUint64()
+		if err != nil {
+			return err
+		}
+		b = strconv.AppendUint(b, n, 10)
+	case msgpcode.IsFloat(c):
+		f, err := t.dec.DecodeFloat64()
+		if err != nil {
+			return err
+		}
+		bitSize := 64
+		if c == msgpcode.Float {
+			bitSize = 32
+		}
+		b = strconv.AppendFloat(b, f, 'g', -1, bitSize)
+	case msgpcode.IsBin(c):
+		data, err := t.dec.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		if t.opt.Bin == BinHex {
+			b = append(b, hex.EncodeToString(data)...)
+		} else {
+			b = append(b, base64.StdEncoding.EncodeToString(data)...)
+		}
+	default:
+		return errors.Errorf("jsonx: unsupported map key code %x", c)
+	}
+	return t.write(append(b, '"'))
+}
+
+// extID peeks the id of the extension starting with code c.
+func (t *toJSON) extID(c byte) (int8, error) {
+	var off int
+	switch c {
+	case msgpcode.FixExt1, msgpcode.FixExt2, msgpcode.FixExt4, msgpcode.FixExt8, msgpcode.FixExt16:
+		off = 1
+	case msgpcode.Ext8:
+		off = 2
+	case msgpcode.Ext16:
+		off = 3
+	case msgpcode.Ext32:
+		off = 5
+	default:
+		return 0, errors.Errorf("jsonx: invalid ext code %x", c)
+	}
+	b, err := t.br.Peek(off + 1)
+	if err != nil {
+		return 0, err
+	}
+	return int8(b[off]), nil
+}
+
+func (t *toJSON) ext() error {
+	c, err := t.dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	id, err := t.extID(c)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case id == internedStringExtID && t.opt.InternedStrings:
+		s, err := t.dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		return t.write(appendString(t.buf[:0], s))
+	case (id == timeExtID || id == timeExtID2) && t.opt.Time != TimeExt:
+		tm, err := t.dec.DecodeTime()
+		if err != nil {
+			return err
+		}
+		if t.opt.Time == TimeUnixMillis {
+			ms := tm.Unix()*1e3 + int64(tm.Nanosecond())/1e6
+			return t.write(strconv.AppendInt(t.buf[:0], ms, 10))
+		}
+		b := append(t.buf[:0], '"')
+		b = tm.UTC().AppendFormat(b, time.RFC3339Nano)
+		return t.write(append(b, '"'))
+	}
+
+	switch t.opt.Ext {
+	case ExtNull:
+		if err := t.dec.Skip(); err != nil {
+			return err
+		}
+		_, err := t.w.WriteString("null")
+		return err
+	case ExtError:
+		return errors.Errorf("jsonx: unsupported msgpack ext id=%d", id)
+	}
+
+	_, extLen, err := t.dec.DecodeExtHeader()
+	if err != nil {
+		return err
+	}
+	b := append(t.buf[:0], `{"type":`...)
+	b = strconv.AppendInt(b, int64(id), 10)
+	b = append(b, `,"data":`...)
+	if err := t.write(b); err != nil {
+		return err
+	}
+	if err := t.extData(extLen); err != nil {
+		return err
+	}
+	return t.w.WriteByte('}')
+}
+
+// extDataChunk is the number of bytes of ext data read at a time.
+const extDataChunk = 512
+
+// extData writes n bytes of ext data in the format of binary data. The data
+// is read in chunks, because n comes from the input and may be forged.
+func (t *toJSON) extData(n int) error {
+	var enc io.WriteCloser
+	switch t.opt.Bin {
+	case BinHex:
+		enc = nopCloser{hex.NewEncoder(t.w)}
+	case BinArray:
+		if err := t.w.WriteByte('['); err != nil {
+			return err
+		}
+	default:
+		enc = base64.NewEncoder(base64.StdEncoding, t.w)
+	}
+	if enc != nil {
+		if err := t.w.WriteByte('"'); err != nil {
+			return err
+		}
+	}
+
+	var chunk [extDataChunk]byte
+	for i := 0; i < n; i += extDataChunk {
+		data := chunk[:]
+		if n-i < len(data) {
+			data = data[:n-i]
+		}
+		if err := t.dec.ReadFull(data); err != nil {
+			return err
+		}
+
+		if enc != nil {
+			if _, err := enc.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		b := t.buf[:0]
+		for j, c := range data {
+			if i+j > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendUint(b, uint64(c), 10)
+		}
+		if err := t.write(b); err != nil {
+			return err
+		}
+	}
+
+	if enc == nil {
+		return t.w.WriteByte(']')
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return t.w.WriteByte('"')
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s to b as a JSON string. Invalid UTF-8 is replaced
+// with U+FFFD.
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
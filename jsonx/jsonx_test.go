@@ -0,0 +1,199 @@
+package jsonx_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/gostudentorg/msgpack/v5/jsonx"
+	"github.com/stretchr/testify/require"
+)
+
+func toJSON(t *testing.T, opt jsonx.Options, v interface{}) (string, error) {
+	b, err := msgpack.Marshal(v)
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	err = opt.ToJSON(&buf, bytes.NewReader(b))
+	return buf.String(), err
+}
+
+func TestToJSON(t *testing.T) {
+	tm := time.Unix(1600000000, 5e8)
+	tests := []struct {
+		opt  jsonx.Options
+		v    interface{}
+		json string
+	}{
+		{jsonx.Options{}, nil, "null"},
+		{jsonx.Options{}, true, "true"},
+		{jsonx.Options{}, int64(math.MinInt64), "-9223372036854775808"},
+		{jsonx.Options{}, uint64(math.MaxUint64), "18446744073709551615"},
+		{jsonx.Options{}, float32(0.1), "0.1"},
+		{jsonx.Options{}, 1.5e300, "1.5e+300"},
+		{jsonx.Options{}, "a\"b\\\n\x01<\xff", `"a\"b\\\n\u0001<` + "�" + `"`},
+		{jsonx.Options{}, []interface{}{1, "a", []int{}}, `[1,"a",[]]`},
+		{jsonx.Options{}, map[string]interface{}{"a": map[string]int{}}, `{"a":{}}`},
+		{jsonx.Options{}, []byte("hi"), `"aGk="`},
+		{jsonx.Options{Bin: jsonx.BinHex}, []byte("hi"), `"6869"`},
+		{jsonx.Options{Bin: jsonx.BinArray}, []byte("hi"), `[104,105]`},
+		{jsonx.Options{}, tm, `"2020-09-13T12:26:40.5Z"`},
+		{jsonx.Options{Time: jsonx.TimeUnixMillis}, tm, `1600000000500`},
+		{jsonx.Options{}, &msgpack.RawExt{Type: -1, Data: []byte{0, 0, 0, 1}}, `"1970-01-01T00:00:01Z"`},
+		{jsonx.Options{Time: jsonx.TimeExt}, time.Unix(1, 0), `{"type":13,"data":"y0CPQAAAAAAA"}`},
+		{jsonx.Options{}, &msgpack.RawExt{Type: 7, Data: []byte{1, 2}}, `{"type":7,"data":"AQI="}`},
+		{jsonx.Options{Bin: jsonx.BinHex}, &msgpack.RawExt{Type: 7, Data: []byte{1, 2}}, `{"type":7,"data":"0102"}`},
+		{jsonx.Options{Bin: jsonx.BinArray}, &msgpack.RawExt{Type: 7, Data: []byte{1, 2}}, `{"type":7,"data":[1,2]}`},
+		{jsonx.Options{Ext: jsonx.ExtNull}, &msgpack.RawExt{Type: 7, Data: []byte{1}}, `null`},
+		{jsonx.Options{}, map[int]bool{-1: true}, `{"-1":true}`},
+		{jsonx.Options{}, map[bool]int{true: 1}, `{"true":1}`},
+		{jsonx.Options{NaN: jsonx.NaNNull}, math.NaN(), `null`},
+		{jsonx.Options{NaN: jsonx.NaNString}, []float64{math.NaN(), math.Inf(-1)}, `["NaN","-Inf"]`},
+	}
+	for _, test := range tests {
+		s, err := toJSON(t, test.opt, test.v)
+		require.Nil(t, err, "%v", test.v)
+		require.Equal(t, test.json+"\n", s, "%v", test.v)
+	}
+
+	for _, test := range []struct {
+		opt jsonx.Options
+		v   interface{}
+	}{
+		{jsonx.Options{}, math.Inf(1)},
+		{jsonx.Options{Ext: jsonx.ExtError}, &msgpack.RawExt{Type: 7}},
+		{jsonx.Options{Keys: jsonx.KeyError}, map[int]int{1: 1}},
+	} {
+		_, err := toJSON(t, test.opt, test.v)
+		require.NotNil(t, err, "%v", test.v)
+	}
+}
+
+func TestToJSONLargeExt(t *testing.T) {
+	data := make([]byte, 1500)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	ext := &msgpack.RawExt{Type: 7, Data: data}
+
+	s, err := toJSON(t, jsonx.Options{}, ext)
+	require.Nil(t, err)
+	require.Equal(t, `{"type":7,"data":"`+base64.StdEncoding.EncodeToString(data)+`"}`+"\n", s)
+
+	s, err = toJSON(t, jsonx.Options{Bin: jsonx.BinArray}, ext)
+	require.Nil(t, err)
+	var v struct {
+		Data []int
+	}
+	require.Nil(t, json.Unmarshal([]byte(s), &v))
+	require.Len(t, v.Data, len(data))
+	require.Equal(t, 255, v.Data[255])
+
+	// The length of the ext is not trusted.
+	var buf bytes.Buffer
+	err = jsonx.ToJSON(&buf, bytes.NewReader([]byte{0xc9, 0x7f, 0xff, 0xff, 0xff, 0x07, 0x01}))
+	require.NotNil(t, err)
+}
+
+func TestToJSONInternedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternedStrings(true)
+	v := []map[string]string{{"name": "hello"}, {"name": "hello"}}
+	require.Nil(t, enc.Encode(v))
+	require.Nil(t, enc.Encode(v))
+
+	var out bytes.Buffer
+	err := jsonx.Options{InternedStrings: true}.ToJSON(&out, &buf)
+	require.Nil(t, err)
+	line := `[{"name":"hello"},{"name":"hello"}]` + "\n"
+	require.Equal(t, line+line, out.String())
+}
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		v    interface{}
+	}{
+		{`null`, nil},
+		{`[true, false]`, []interface{}{true, false}},
+		{`9223372036854775807`, uint64(math.MaxInt64)},
+		{`-9223372036854775808`, int64(math.MinInt64)},
+		{`18446744073709551615`, uint64(math.MaxUint64)},
+		{`1`, int8(1)},
+		{`1.0`, 1.0},
+		{`1e2`, 100.0},
+		{`"aé"`, "aé"},
+		{`{"a": [1, {"b": null}], "c": {}}`, map[string]interface{}{
+			"a": []interface{}{int8(1), map[string]interface{}{"b": nil}},
+			"c": map[string]interface{}{},
+		}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		require.Nil(t, jsonx.FromJSON(&buf, strings.NewReader(test.json)), test.json)
+
+		var v interface{}
+		require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &v), test.json)
+		require.Equal(t, test.v, v, test.json)
+	}
+
+	// Containers use the shortest header.
+	var buf bytes.Buffer
+	require.Nil(t, jsonx.FromJSON(&buf, strings.NewReader(`{"a":[1,2]} [] 3`)))
+	require.Equal(t, "81a16192010290"+"03", hex.EncodeToString(buf.Bytes()))
+
+	for _, in := range []string{`[1,`, `{"a"}`, `]`, `1e400`} {
+		require.NotNil(t, jsonx.FromJSON(&buf, strings.NewReader(in)), in)
+	}
+
+	// The Options are ignored, so the output of ToJSON is not reversed.
+	in := `[{"type":7,"data":"0102"},"2020-09-13T12:26:40Z","NaN"]`
+	var def, opt bytes.Buffer
+	require.Nil(t, jsonx.FromJSON(&def, strings.NewReader(in)))
+	require.Nil(t, jsonx.Options{
+		Bin:  jsonx.BinHex,
+		Time: jsonx.TimeRFC3339,
+		NaN:  jsonx.NaNString,
+	}.FromJSON(&opt, strings.NewReader(in)))
+	require.Equal(t, def.Bytes(), opt.Bytes())
+
+	var v []interface{}
+	require.Nil(t, msgpack.Unmarshal(opt.Bytes(), &v))
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"type": int8(7), "data": "0102"},
+		"2020-09-13T12:26:40Z",
+		"NaN",
+	}, v)
+}
+
+func TestFromJSONDeep(t *testing.T) {
+	// Deeply nested containers around a large value are written in linear
+	// time, not by moving the value once per container.
+	const depth = 9000
+	leaf := strings.Repeat("x", 1<<20)
+	in := strings.Repeat("[", depth) + `"` + leaf + `"` + strings.Repeat("]", depth)
+
+	var buf bytes.Buffer
+	require.Nil(t, jsonx.FromJSON(&buf, strings.NewReader(in)))
+
+	want, err := msgpack.Marshal(leaf)
+	require.Nil(t, err)
+	want = append(bytes.Repeat([]byte{0x91}, depth), want...)
+	require.Equal(t, want, buf.Bytes())
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := `{"id":12345678901234,"name":"x","tags":["a","b"],"score":0.25,"ok":true,"none":null}`
+	var mp bytes.Buffer
+	require.Nil(t, jsonx.FromJSON(&mp, strings.NewReader(in)))
+
+	var out bytes.Buffer
+	require.Nil(t, jsonx.ToJSON(&out, &mp))
+	require.Equal(t, in+"\n", out.String())
+}
@@ -1,6 +1,9 @@
 package msgpack
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 type Marshaler interface {
 	MarshalMsgpack() ([]byte, error)
@@ -28,6 +31,13 @@ var (
 )
 
 func (m RawMessage) EncodeMsgpack(enc *Encoder) error {
+	if enc.flags&canonicalFlag != 0 {
+		b, err := Canonicalize(m)
+		if err != nil {
+			return err
+		}
+		return enc.write(b)
+	}
 	return enc.write(m)
 }
 
@@ -40,6 +50,33 @@ func (m *RawMessage) DecodeMsgpack(dec *Decoder) error {
 	return nil
 }
 
+// RawExt is a MessagePack extension that is kept as is. Decoders with
+// UseRawExt enabled decode unknown extensions into interface{} as *RawExt.
+type RawExt struct {
+	Type int8
+	Data []byte
+}
+
+var (
+	_ CustomEncoder = RawExt{}
+	_ CustomDecoder = (*RawExt)(nil)
+)
+
+func (ext RawExt) EncodeMsgpack(enc *Encoder) error {
+	if err := enc.EncodeExtHeader(ext.Type, len(ext.Data)); err != nil {
+		return err
+	}
+	return enc.write(ext.Data)
+}
+
+func (ext *RawExt) DecodeMsgpack(dec *Decoder) error {
+	extID, extLen, err := dec.DecodeExtHeader()
+	if err != nil {
+		return err
+	}
+	return dec.decodeRawExt(ext, extID, extLen)
+}
+
 //------------------------------------------------------------------------------
 
 type unexpectedCodeError struct {
@@ -50,3 +87,31 @@ type unexpectedCodeError struct {
 func (err unexpectedCodeError) Error() string {
 	return fmt.Sprintf("msgpack: unexpected code=%x decoding %s", err.code, err.hint)
 }
+
+// TypeMismatchError is returned by a Decoder in strict mode (see Decoder.UseStrictTypes)
+// when a msgpack value does not match the requested Go kind.
+type TypeMismatchError struct {
+	Kind reflect.Kind // expected Go kind
+	Code byte         // msgpack code found in the input
+}
+
+func (err *TypeMismatchError) Error() string {
+	return fmt.Sprintf("msgpack: unexpected code=%x decoding %s in strict mode", err.Code, err.Kind)
+}
+
+// DecodeError is returned by a Decoder when decoding a value nested in a map,
+// struct or array fails. It tells where in the input the error occurred.
+type DecodeError struct {
+	Path   string // e.g. "items[2].id"
+	Offset int64  // number of bytes read when the error occurred
+	Code   byte   // last msgpack code read
+	Err    error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("%s (path=%s offset=%d)", err.Err, err.Path, err.Offset)
+}
+
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
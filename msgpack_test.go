@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"testing"
@@ -476,3 +478,751 @@ func TestEncodeWrappedValue(t *testing.T) {
 	require.Nil(t, msgpack.NewEncoder(&buf).Encode(v))
 	require.Nil(t, msgpack.NewEncoder(&buf).Encode(c))
 }
+
+func TestStrictTypes(t *testing.T) {
+	type Item struct {
+		ID int64
+	}
+
+	b, err := msgpack.Marshal(map[string]interface{}{"ID": "abc"})
+	require.Nil(t, err)
+
+	var item Item
+	require.Nil(t, msgpack.Unmarshal(b, &item))
+	require.Equal(t, int64(0), item.ID)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.UseStrictTypes(true)
+	err = dec.Decode(&item)
+	require.NotNil(t, err)
+
+	decErr, ok := err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T", err)
+	require.Equal(t, "ID", decErr.Path)
+
+	typeErr, ok := decErr.Err.(*msgpack.TypeMismatchError)
+	require.True(t, ok, "got %T", decErr.Err)
+	require.Equal(t, reflect.Int64, typeErr.Kind)
+	require.Equal(t, byte(0xa3), typeErr.Code)
+	require.Equal(t, "msgpack: unexpected code=a3 decoding int64 in strict mode", typeErr.Error())
+
+	tests := []struct {
+		in  interface{}
+		out interface{}
+	}{
+		{in: "true", out: new(bool)},
+		{in: 1.5, out: new(uint64)},
+		{in: "1.5", out: new(float64)},
+		{in: 42, out: new(string)},
+		{in: "abc", out: new([]int)},
+		{in: []int{1}, out: new(map[string]interface{})},
+	}
+	for _, test := range tests {
+		b, err := msgpack.Marshal(test.in)
+		require.Nil(t, err)
+
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.UseStrictTypes(true)
+		err = dec.Decode(test.out)
+		_, ok := err.(*msgpack.TypeMismatchError)
+		require.True(t, ok, "in=%#v out=%T err=%v", test.in, test.out, err)
+	}
+
+	for _, in := range []interface{}{nil, int8(-3), uint32(7)} {
+		b, err := msgpack.Marshal(in)
+		require.Nil(t, err)
+
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.UseStrictTypes(true)
+		var f float64
+		require.Nil(t, dec.Decode(&f))
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	type Item struct {
+		ID    uint8
+		Count int16
+	}
+
+	b, err := msgpack.Marshal(struct {
+		ID    int
+		Count int
+	}{ID: 300, Count: -40000})
+	require.Nil(t, err)
+
+	var item Item
+	require.Nil(t, msgpack.Unmarshal(b, &item))
+	require.Equal(t, Item{ID: 44, Count: 25536}, item)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetOverflowPolicy(msgpack.OverflowSaturate)
+	require.Nil(t, dec.Decode(&item))
+	require.Equal(t, Item{ID: math.MaxUint8, Count: math.MinInt16}, item)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetOverflowPolicy(msgpack.OverflowError)
+	err = dec.Decode(&item)
+	decErr, ok := err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T", err)
+	require.Equal(t, "ID", decErr.Path)
+	convErr, ok := decErr.Err.(*msgpack.ConversionError)
+	require.True(t, ok, "got %T", decErr.Err)
+	require.Equal(t, msgpack.ConversionOverflow, convErr.Reason)
+	require.Equal(t, reflect.TypeOf(uint8(0)), convErr.To)
+
+	tests := []struct {
+		in        interface{}
+		out       interface{}
+		saturated interface{}
+	}{
+		{in: uint64(math.MaxUint64), out: new(int64), saturated: int64(math.MaxInt64)},
+		{in: -1, out: new(uint64), saturated: uint64(0)},
+		{in: -1, out: new(uint), saturated: uint(0)},
+		{in: 1 << 20, out: new(int8), saturated: int8(math.MaxInt8)},
+		{in: 70000, out: new(uint16), saturated: uint16(math.MaxUint16)},
+		{in: "1e30", out: new(int32), saturated: int32(math.MaxInt32)},
+		{in: -1e30, out: new(uint32), saturated: uint32(0)},
+	}
+	for _, test := range tests {
+		b, err := msgpack.Marshal(test.in)
+		require.Nil(t, err)
+
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetOverflowPolicy(msgpack.OverflowSaturate)
+		require.Nil(t, dec.Decode(test.out))
+		require.Equal(t, test.saturated, reflect.ValueOf(test.out).Elem().Interface(), "in=%#v", test.in)
+
+		dec = msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetOverflowPolicy(msgpack.OverflowError)
+		_, ok := dec.Decode(test.out).(*msgpack.ConversionError)
+		require.True(t, ok, "in=%#v out=%T", test.in, test.out)
+	}
+
+	b, err = msgpack.Marshal(1.5)
+	require.Nil(t, err)
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetOverflowPolicy(msgpack.OverflowError)
+	_, err = dec.DecodeInt()
+	convErr, ok = err.(*msgpack.ConversionError)
+	require.True(t, ok, "got %T", err)
+	require.Equal(t, msgpack.ConversionPrecisionLoss, convErr.Reason)
+}
+
+func TestTimeFormat(t *testing.T) {
+	type Event struct {
+		At time.Time
+	}
+
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	millis := tm.Truncate(time.Millisecond)
+
+	tests := []struct {
+		format    msgpack.TimeFormat
+		prefix    string
+		wanted    time.Time
+		precision time.Duration
+	}{
+		{format: msgpack.TimeFormatMillisFloat, prefix: "c709", wanted: millis, precision: time.Millisecond},
+		{format: msgpack.TimeFormatSpec, prefix: "d7ff", wanted: tm},
+		{format: msgpack.TimeFormatRFC3339, prefix: "be", wanted: tm},
+		{format: msgpack.TimeFormatUnixInt, prefix: "d3", wanted: millis},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetTimeFormat(test.format)
+		require.Nil(t, enc.Encode(tm))
+		require.Equal(t, test.prefix, fmt.Sprintf("%x", buf.Bytes()[:len(test.prefix)/2]))
+
+		var out time.Time
+		require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &out))
+		require.True(t, out.Round(test.precision).Equal(test.wanted), "format=%d got %s", test.format, out)
+
+		buf.Reset()
+		require.Nil(t, enc.Encode(Event{At: tm}))
+		var event Event
+		require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &event))
+		require.True(t, event.At.Round(test.precision).Equal(test.wanted), "format=%d got %s", test.format, event.At)
+	}
+
+	for _, in := range []time.Time{
+		time.Unix(1<<32-1, 0),
+		time.Unix(1<<34-1, 999999999),
+		time.Unix(-1, 0),
+		{},
+	} {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetTimeFormat(msgpack.TimeFormatSpec)
+		require.Nil(t, enc.Encode(in))
+
+		var out time.Time
+		require.Nil(t, msgpack.Unmarshal(buf.Bytes(), &out))
+		require.True(t, out.Equal(in), "in=%s out=%s", in, out)
+	}
+}
+
+func TestTimeOptions(t *testing.T) {
+	type Event struct {
+		At time.Time
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		in     interface{}
+		opts   msgpack.TimeOptions
+		wanted time.Time
+	}{
+		{
+			in:     int64(1614834367123),
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 123e6, time.UTC),
+		},
+		{
+			in:     int64(1614834367),
+			opts:   msgpack.TimeOptions{IntUnit: time.Second},
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		},
+		{
+			in:     int64(1614834367123456),
+			opts:   msgpack.TimeOptions{IntUnit: time.Microsecond},
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 123456e3, time.UTC),
+		},
+		{
+			in:     int64(1614834367123456789),
+			opts:   msgpack.TimeOptions{IntUnit: time.Nanosecond},
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC),
+		},
+		{
+			in:     int64(3),
+			opts:   msgpack.TimeOptions{IntUnit: 1500 * time.Millisecond},
+			wanted: time.Unix(4, 5e8),
+		},
+		{
+			in:     int64(333),
+			opts:   msgpack.TimeOptions{IntUnit: 3 * time.Millisecond},
+			wanted: time.Unix(0, 999e6),
+		},
+		{
+			in:     int64(-1),
+			opts:   msgpack.TimeOptions{IntUnit: 3 * time.Millisecond},
+			wanted: time.Unix(0, -3e6),
+		},
+		{
+			in:     int64(1e12),
+			opts:   msgpack.TimeOptions{IntUnit: time.Second},
+			wanted: time.Unix(1e12, 0),
+		},
+		{
+			in:     int64(-1e12),
+			opts:   msgpack.TimeOptions{IntUnit: 1500 * time.Millisecond},
+			wanted: time.Unix(-15e11, 0),
+		},
+		{
+			in:     "2021-03-04 05:06:07",
+			opts:   msgpack.TimeOptions{Layouts: []string{"2006-01-02 15:04:05"}},
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		},
+		{
+			in:     "2021-03-04 05:06:07",
+			opts:   msgpack.TimeOptions{Layouts: []string{"2006-01-02 15:04:05"}, Location: berlin},
+			wanted: time.Date(2021, 3, 4, 5, 6, 7, 0, berlin),
+		},
+	}
+	for _, test := range tests {
+		b, err := msgpack.Marshal(test.in)
+		require.Nil(t, err)
+
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetTimeOptions(test.opts)
+		tm, err := dec.DecodeTime()
+		require.Nil(t, err)
+		require.True(t, tm.Equal(test.wanted), "in=%v got %s", test.in, tm)
+
+		b, err = msgpack.Marshal(map[string]interface{}{"At": test.in})
+		require.Nil(t, err)
+
+		dec = msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetTimeOptions(test.opts)
+		var event Event
+		require.Nil(t, dec.Decode(&event))
+		require.True(t, event.At.Equal(test.wanted), "in=%v got %s", test.in, event.At)
+	}
+
+	b, err := msgpack.Marshal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	require.Nil(t, err)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetTimeOptions(msgpack.TimeOptions{Location: time.UTC})
+	var tm time.Time
+	require.Nil(t, dec.Decode(&tm))
+	require.Equal(t, time.UTC, tm.Location())
+
+	b, err = msgpack.Marshal(int64(math.MaxInt64))
+	require.Nil(t, err)
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetTimeOptions(msgpack.TimeOptions{IntUnit: time.Hour})
+	_, err = dec.DecodeTime()
+	convErr, ok := err.(*msgpack.ConversionError)
+	require.True(t, ok, "got %T", err)
+	require.Equal(t, msgpack.ConversionOverflow, convErr.Reason)
+}
+
+func TestTimeCodec(t *testing.T) {
+	type Event struct {
+		At    time.Time
+		Times []time.Time
+		ByKey map[string]time.Time
+		Ptr   *time.Time
+	}
+
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	in := Event{
+		At:    tm,
+		Times: []time.Time{tm},
+		ByKey: map[string]time.Time{"a": tm},
+		Ptr:   &tm,
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetTimeEncoder(func(e *msgpack.Encoder, tm time.Time) error {
+		return e.EncodeString(tm.Format("2006-01-02"))
+	})
+	require.Nil(t, enc.Encode(in))
+	require.Nil(t, enc.Encode(tm))
+
+	var decoded []string
+	dec := msgpack.NewDecoder(&buf)
+	dec.SetTimeDecoder(func(d *msgpack.Decoder) (time.Time, error) {
+		s, err := d.DecodeString()
+		if err != nil {
+			return time.Time{}, err
+		}
+		decoded = append(decoded, s)
+		return time.Parse("2006-01-02", s)
+	})
+
+	var out Event
+	require.Nil(t, dec.Decode(&out))
+	day := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, Event{
+		At:    day,
+		Times: []time.Time{day},
+		ByKey: map[string]time.Time{"a": day},
+		Ptr:   &day,
+	}, out)
+
+	var top time.Time
+	require.Nil(t, dec.Decode(&top))
+	require.Equal(t, day, top)
+	require.Equal(t, 5, len(decoded))
+
+	b, err := msgpack.Marshal(map[string]interface{}{"At": nil})
+	require.Nil(t, err)
+	out.At = tm
+	require.Nil(t, msgpack.Unmarshal(b, &out))
+	require.True(t, out.At.IsZero())
+}
+
+func TestDecodeErrorPath(t *testing.T) {
+	type Item struct {
+		ID int64
+	}
+	type Order struct {
+		Items []Item
+		Meta  map[string]interface{}
+	}
+
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"Items": []interface{}{
+			map[string]interface{}{"ID": 1},
+			map[string]interface{}{"ID": []int{2}},
+		},
+	})
+	require.Nil(t, err)
+
+	var order Order
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.UseStrictTypes(true)
+	err = dec.Decode(&order)
+	decErr, ok := err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T: %v", err, err)
+	require.Equal(t, "Items[1].ID", decErr.Path)
+	require.Equal(t, byte(0x91), decErr.Code)
+	require.Equal(t, int64(18), decErr.Offset)
+	require.Equal(t, "msgpack: unexpected code=91 decoding int64 in strict mode (path=Items[1].ID offset=18)", err.Error())
+
+	b, err = msgpack.Marshal(map[string]interface{}{"Meta": map[string]interface{}{"a": []int{1, 2}}})
+	require.Nil(t, err)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b[:len(b)-1]))
+	err = dec.Decode(&order)
+	decErr, ok = err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T: %v", err, err)
+	require.Equal(t, "Meta.a[1]", decErr.Path)
+	require.Equal(t, io.EOF, decErr.Unwrap())
+	require.Equal(t, int64(len(b)-1), dec.InputOffset())
+
+	dec = msgpack.NewDecoder(bytes.NewReader(nil))
+	require.Equal(t, io.EOF, dec.Decode(&order))
+
+	b, err = msgpack.Marshal(map[string]interface{}{"ID": 1, "Name": "x"})
+	require.Nil(t, err)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields(true)
+	var item Item
+	err = dec.Decode(&item)
+	decErr, ok = err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T: %v", err, err)
+	require.Equal(t, "Name", decErr.Path)
+
+	b, err = msgpack.Marshal([]interface{}{1, "two", 3.0})
+	require.Nil(t, err)
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	var n int
+	_, err = dec.DecodeArrayLen()
+	require.Nil(t, err)
+	require.Nil(t, dec.Decode(&n))
+	require.Equal(t, int64(2), dec.InputOffset())
+	require.Nil(t, dec.Skip())
+	require.Equal(t, int64(6), dec.InputOffset())
+}
+
+func TestQuery(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"a.b": 1,
+		"items": []interface{}{
+			map[string]interface{}{"id": 1, "status": "active", "price": 10},
+			map[string]interface{}{"id": 2, "status": "deleted", "price": 20},
+			map[string]interface{}{"id": 3, "status": "active", "price": 30, "tags": []string{"x"}},
+		},
+		"meta": map[string]interface{}{"id": 4},
+	})
+	require.Nil(t, err)
+
+	tests := []struct {
+		query  string
+		values []interface{}
+	}{
+		{`"a.b"`, []interface{}{int8(1)}},
+		{`['a.b']`, []interface{}{int8(1)}},
+		{`items.-1.id`, []interface{}{int8(3)}},
+		{`items[-2].id`, []interface{}{int8(2)}},
+		{`items[1:].id`, []interface{}{int8(2), int8(3)}},
+		{`items[:-2].id`, []interface{}{int8(1)}},
+		{`items[*].id`, []interface{}{int8(1), int8(2), int8(3)}},
+		{`meta.*`, []interface{}{int8(4)}},
+		{`items[?status=="active"].id`, []interface{}{int8(1), int8(3)}},
+		{`items[?status != 'active'].id`, []interface{}{int8(2)}},
+		{`items[?price>=20].id`, []interface{}{int8(2), int8(3)}},
+		{`items[?tags].id`, []interface{}{int8(3)}},
+		{`items[?tags[0]=="x"].id`, []interface{}{int8(3)}},
+		{`items[5].id`, nil},
+		{`items[-4].id`, nil},
+		{`items[-10].id`, nil},
+		{`items.-10.id`, nil},
+		{`items[-10:1].id`, []interface{}{int8(1)}},
+		{`items[?tags[-2]].id`, nil},
+		{`items.id`, nil},
+		{`items.x`, nil},
+		{`meta.id.x`, nil},
+		{`items[0].id[0]`, nil},
+		{`..tags[0]`, []interface{}{"x"}},
+	}
+	for _, test := range tests {
+		values, err := msgpack.NewDecoder(bytes.NewReader(b)).Query(test.query)
+		require.Nil(t, err, test.query)
+		require.Equal(t, test.values, values, test.query)
+	}
+
+	// Map keys are encoded in random order, so recursive matches are unordered.
+	values, err := msgpack.NewDecoder(bytes.NewReader(b)).Query("..id")
+	require.Nil(t, err)
+	require.ElementsMatch(t, []interface{}{int8(1), int8(2), int8(3), int8(4)}, values)
+
+	// Queries of plain keys and indexes don't allocate.
+	plain := msgpack.MustCompileQuery("items.1.id")
+	dec := msgpack.NewDecoder(nil)
+	var id int
+	allocs := testing.AllocsPerRun(100, func() {
+		dec.ResetBytes(b)
+		if _, err := dec.RunOne(plain, &id); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Equal(t, 2, id)
+	require.Equal(t, 0.0, allocs)
+
+	b, err = msgpack.Marshal([]interface{}{
+		map[string]interface{}{"id": 1, "child": map[string]interface{}{"id": 2}},
+	})
+	require.Nil(t, err)
+
+	values, err = msgpack.NewDecoder(bytes.NewReader(b)).Query("..id")
+	require.Nil(t, err)
+	require.ElementsMatch(t, []interface{}{int8(1), int8(2)}, values)
+
+	for _, query := range []string{"a.", ".a", "a..", "a[", "a[1", "a[x]", `a["x`, "a[?]", "a[?b==]", "a[1:x]"} {
+		_, err := msgpack.NewDecoder(bytes.NewReader(b)).Query(query)
+		require.NotNil(t, err, query)
+	}
+}
+
+func TestQueryInto(t *testing.T) {
+	type User struct {
+		ID   int
+		Name string
+	}
+
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"payload": map[string]interface{}{
+			"user":  map[string]interface{}{"ID": 1, "Name": "alice"},
+			"users": []interface{}{map[string]interface{}{"ID": 2}, map[string]interface{}{"ID": 3}},
+		},
+	})
+	require.Nil(t, err)
+
+	var user User
+	err = msgpack.NewDecoder(bytes.NewReader(b)).QueryInto("payload.user", &user)
+	require.Nil(t, err)
+	require.Equal(t, User{ID: 1, Name: "alice"}, user)
+
+	users := []User{{ID: 42}}
+	err = msgpack.NewDecoder(bytes.NewReader(b)).QueryInto("payload.users[*]", &users)
+	require.Nil(t, err)
+	require.Equal(t, []User{{ID: 2}, {ID: 3}}, users)
+
+	var ids []int64
+	err = msgpack.NewDecoder(bytes.NewReader(b)).QueryInto("payload.users[*].ID", &ids)
+	require.Nil(t, err)
+	require.Equal(t, []int64{2, 3}, ids)
+
+	var id int
+	err = msgpack.NewDecoder(bytes.NewReader(b)).QueryInto("payload.users[*].ID", &id)
+	require.NotNil(t, err)
+
+	var name string
+	found, err := msgpack.NewDecoder(bytes.NewReader(b)).QueryOne("payload.user.Name", &name)
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, "alice", name)
+
+	found, err = msgpack.NewDecoder(bytes.NewReader(b)).QueryOne("payload.users[*].ID", &id)
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, 2, id)
+
+	found, err = msgpack.NewDecoder(bytes.NewReader(b)).QueryOne("payload.missing", &name)
+	require.Nil(t, err)
+	require.False(t, found)
+}
+
+func TestCompileQuery(t *testing.T) {
+	_, err := msgpack.CompileQuery("a[")
+	require.NotNil(t, err)
+	require.Panics(t, func() { msgpack.MustCompileQuery("a..") })
+
+	id := msgpack.MustCompileQuery("user.id")
+	ts := msgpack.MustCompileQuery("meta.ts")
+	tags := msgpack.MustCompileQuery("tags[*]")
+	require.Equal(t, "user.id", id.String())
+
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"user": map[string]interface{}{"id": 1},
+		"meta": map[string]interface{}{"ts": 2},
+		"tags": []string{"a", "b"},
+	})
+	require.Nil(t, err)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	values, err := dec.RunMulti(id, ts, tags, id)
+	require.Nil(t, err)
+	require.Equal(t, [][]interface{}{
+		{int8(1)},
+		{int8(2)},
+		{"a", "b"},
+		{int8(1)},
+	}, values)
+
+	dec.Reset(bytes.NewReader(b))
+	value, err := dec.Run(ts)
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{int8(2)}, value)
+
+	var n int
+	dec.Reset(bytes.NewReader(b))
+	found, err := dec.RunOne(id, &n)
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, 1, n)
+}
+
+func TestExtract(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"user": map[string]interface{}{"id": 1, "roles": []string{"admin", "dev"}},
+		"meta": map[string]interface{}{"ts": 2},
+		"body": []int{1, 2, 3},
+	})
+	require.Nil(t, err)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	m, err := dec.Extract(map[string]string{
+		"uid":     "user.id",
+		"ts":      "meta.ts",
+		"roles":   "user.roles[*]",
+		"missing": "meta.missing",
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string][]interface{}{
+		"uid":   {int8(1)},
+		"ts":    {int8(2)},
+		"roles": {"admin", "dev"},
+	}, m)
+
+	_, err = dec.Extract(map[string]string{"bad": "a["})
+	require.NotNil(t, err)
+}
+
+func TestResetBytes(t *testing.T) {
+	type Item struct {
+		Name string
+		Data []byte
+		Tags []string
+		N    int64
+	}
+	in := Item{Name: "hello", Data: []byte{1, 2, 3}, Tags: []string{"a", "b"}, N: 300}
+
+	b, err := msgpack.Marshal(in)
+	require.Nil(t, err)
+	b = append(b, 0xc3) // trailing true
+
+	dec := msgpack.NewDecoder(nil)
+	dec.ResetBytes(b)
+	var out Item
+	require.Nil(t, dec.Decode(&out))
+	require.Equal(t, in, out)
+	require.Equal(t, int64(len(b)-1), dec.InputOffset())
+
+	buffered, err := ioutil.ReadAll(dec.Buffered())
+	require.Nil(t, err)
+	require.Equal(t, []byte{0xc3}, buffered)
+
+	v, err := dec.DecodeBool()
+	require.Nil(t, err)
+	require.True(t, v)
+	_, err = dec.DecodeBool()
+	require.Equal(t, io.EOF, err)
+
+	// Decoded values don't share memory with the input by default.
+	dec.ResetBytes(b)
+	raw, err := dec.DecodeRaw()
+	require.Nil(t, err)
+	require.Equal(t, b[:len(b)-1], []byte(raw))
+	raw[0] = 0
+	require.NotEqual(t, byte(0), b[0])
+
+	dec.ResetBytes(b)
+	out = Item{}
+	require.Nil(t, dec.Decode(&out))
+	out.Data[0] = 42
+	require.Equal(t, in, func() Item {
+		var item Item
+		require.Nil(t, msgpack.Unmarshal(b, &item))
+		return item
+	}())
+
+	// With zero copy, they do.
+	dec.ResetBytes(b)
+	dec.UseZeroCopy(true)
+	out = Item{}
+	require.Nil(t, dec.Decode(&out))
+	require.Equal(t, in, out)
+	out.Data[0] = 42
+	require.True(t, bytes.Contains(b, []byte{42, 2, 3}))
+
+	err = msgpack.Unmarshal(b[:len(b)-3], &out)
+	require.NotNil(t, err)
+	decErr, ok := err.(*msgpack.DecodeError)
+	require.True(t, ok, "got %T: %v", err, err)
+	require.Equal(t, io.ErrUnexpectedEOF, decErr.Unwrap())
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+	marshal := func(v interface{}) []byte {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.UseCanonicalEncoding(true)
+		require.Nil(t, enc.Encode(v))
+		return buf.Bytes()
+	}
+	keys := func(b []byte) []interface{} {
+		var keys []interface{}
+		it := msgpack.NewDecoder(bytes.NewReader(b)).MapIter()
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+		require.Nil(t, it.Err())
+		return keys
+	}
+
+	m := make(map[int]string)
+	for i := -50; i < 50; i++ {
+		m[i*7] = fmt.Sprint(i)
+	}
+	b := marshal(m)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, b, marshal(m))
+	}
+	got := keys(b)
+	require.Len(t, got, 100)
+	// Non-negative ints are encoded as uint and sort before negative ints.
+	require.Equal(t, int8(0), got[0])
+	require.Equal(t, int8(-7), got[len(got)-1])
+
+	require.Equal(t, []interface{}{"a", "b", "aa"},
+		keys(marshal(map[string]int{"aa": 1, "b": 2, "a": 3})))
+	require.Equal(t, []interface{}{"a", "b", "aa"},
+		keys(marshal(map[string]interface{}{"aa": 1, "b": 2, "a": 3})))
+	require.Equal(t, []interface{}{"a", "b", "aa"},
+		keys(marshal(map[string]string{"aa": "", "b": "", "a": ""})))
+
+	type fields struct {
+		B  int
+		AA int `msgpack:"aa"`
+		A  int
+	}
+	require.Equal(t, []interface{}{"A", "B", "aa"}, keys(marshal(fields{})))
+
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{int64(1), "01"},
+		{uint64(300), "cd012c"},
+		{int32(-1), "ff"},
+		{1.5, "ca3fc00000"},
+		{0.1, "cb3fb999999999999a"},
+		{math.NaN(), "ca7fc00000"},
+		{math.Float64frombits(0x7ff8000000000001), "ca7fc00000"},
+		{float32(math.NaN()), "ca7fc00000"},
+		{time.Unix(1, 0), "d6ff00000001"},
+		{time.Unix(1, 0).In(time.FixedZone("X", 3600)), "d6ff00000001"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.want, fmt.Sprintf("%x", marshal(test.v)), "%#v", test.v)
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCanonicalEncoding(true)
+	enc.UseInternedStrings(true)
+	require.Nil(t, enc.EncodeMulti("hello", "hello"))
+	require.Equal(t, "a568656c6c6fa568656c6c6f", fmt.Sprintf("%x", buf.Bytes()))
+}
@@ -110,3 +110,87 @@ func IsFixedExt(c byte) bool {
 func IsExt(c byte) bool {
 	return IsFixedExt(c) || c == Ext8 || c == Ext16 || c == Ext32
 }
+
+// Name returns the name of code c, e.g. "fixmap" or "uint16".
+//
+//nolint:gocyclo
+func Name(c byte) string {
+	switch {
+	case c <= PosFixedNumHigh:
+		return "positive fixint"
+	case c >= NegFixedNumLow:
+		return "negative fixint"
+	case IsFixedMap(c):
+		return "fixmap"
+	case IsFixedArray(c):
+		return "fixarray"
+	case IsFixedString(c):
+		return "fixstr"
+	}
+
+	switch c {
+	case Nil:
+		return "nil"
+	case False:
+		return "false"
+	case True:
+		return "true"
+	case Bin8:
+		return "bin8"
+	case Bin16:
+		return "bin16"
+	case Bin32:
+		return "bin32"
+	case Ext8:
+		return "ext8"
+	case Ext16:
+		return "ext16"
+	case Ext32:
+		return "ext32"
+	case Float:
+		return "float32"
+	case Double:
+		return "float64"
+	case Uint8:
+		return "uint8"
+	case Uint16:
+		return "uint16"
+	case Uint32:
+		return "uint32"
+	case Uint64:
+		return "uint64"
+	case Int8:
+		return "int8"
+	case Int16:
+		return "int16"
+	case Int32:
+		return "int32"
+	case Int64:
+		return "int64"
+	case FixExt1:
+		return "fixext1"
+	case FixExt2:
+		return "fixext2"
+	case FixExt4:
+		return "fixext4"
+	case FixExt8:
+		return "fixext8"
+	case FixExt16:
+		return "fixext16"
+	case Str8:
+		return "str8"
+	case Str16:
+		return "str16"
+	case Str32:
+		return "str32"
+	case Array16:
+		return "array16"
+	case Array32:
+		return "array32"
+	case Map16:
+		return "map16"
+	case Map32:
+		return "map32"
+	}
+	return "never used"
+}
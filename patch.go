@@ -0,0 +1,262 @@
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/gostudentorg/msgpack/v5/msgpcode"
+	"gitlab.gostudent.cloud/pkg/log/errors"
+)
+
+// ErrPathNotFound is returned by Set, Delete and Insert when the path
+// does not exist in the document.
+var ErrPathNotFound = errors.New("msgpack: path not found")
+
+// Set replaces the value at path in the msgpack document data with the
+// encoding of value. When the last path segment is a map key that does
+// not exist, the key is appended to the map. The path uses the syntax of
+// Decoder.Query, but may only contain map keys and array indexes.
+//
+// Only the replaced value and the headers of modified maps are rewritten;
+// the rest of the document is copied verbatim.
+func Set(data []byte, path string, value interface{}) ([]byte, error) {
+	return patch(data, path, patchSet, value)
+}
+
+// Delete removes the map entry or array element at path.
+func Delete(data []byte, path string) ([]byte, error) {
+	return patch(data, path, patchDelete, nil)
+}
+
+// Insert inserts value at path. When the last path segment is an array
+// index, value is inserted before the element with that index, or appended
+// when the index equals the array length. When it is a map key, the key is
+// appended to the map and must not already exist.
+func Insert(data []byte, path string, value interface{}) ([]byte, error) {
+	return patch(data, path, patchInsert, value)
+}
+
+type patchOp int
+
+const (
+	patchSet patchOp = iota
+	patchDelete
+	patchInsert
+)
+
+// patchTarget describes the position of the last path segment in its parent.
+type patchTarget struct {
+	isMap bool
+	len   int
+
+	headerStart, headerEnd int
+	end                    int // end of the parent
+
+	found                bool
+	entryStart, valStart int
+	entryEnd             int
+}
+
+func patch(data []byte, path string, op patchOp, value interface{}) ([]byte, error) {
+	q, err := CompileQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	if !q.single {
+		return nil, errors.Errorf("msgpack: path %q must contain only map keys and array indexes", path)
+	}
+
+	var b []byte
+	if op != patchDelete {
+		b, err = Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(q.segs) == 0 {
+		if op != patchSet {
+			return nil, ErrPathNotFound
+		}
+		return b, nil
+	}
+
+	d := new(Decoder)
+	d.ResetBytes(data)
+	t, err := d.patchTarget(q.segs)
+	if err != nil {
+		return nil, err
+	}
+	seg := &q.segs[len(q.segs)-1]
+
+	switch op {
+	case patchSet:
+		if t.found {
+			return splice(data, t.valStart, t.entryEnd, b), nil
+		}
+		if !t.isMap {
+			return nil, ErrPathNotFound
+		}
+		return appendMapEntry(data, t, seg.key, b)
+	case patchDelete:
+		if !t.found {
+			return nil, ErrPathNotFound
+		}
+		header, err := patchHeader(t.isMap, t.len-1)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, len(data))
+		out = append(out, data[:t.headerStart]...)
+		out = append(out, header...)
+		out = append(out, data[t.headerEnd:t.entryStart]...)
+		out = append(out, data[t.entryEnd:]...)
+		return out, nil
+	}
+
+	if t.isMap {
+		if t.found {
+			return nil, errors.Errorf("msgpack: key %q already exists", seg.key)
+		}
+		return appendMapEntry(data, t, seg.key, b)
+	}
+
+	pos := t.end
+	if t.found {
+		pos = t.entryStart
+	} else if !seg.isIndex || resolveIndex(seg.index, t.len+1) != t.len {
+		return nil, ErrPathNotFound
+	}
+
+	header, err := patchHeader(false, t.len+1)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(data)+len(b)+len(header))
+	out = append(out, data[:t.headerStart]...)
+	out = append(out, header...)
+	out = append(out, data[t.headerEnd:pos]...)
+	out = append(out, b...)
+	out = append(out, data[pos:]...)
+	return out, nil
+}
+
+// patchTarget follows segs and returns the position of the last segment.
+func (d *Decoder) patchTarget(segs []querySegment) (*patchTarget, error) {
+	for i := range segs {
+		seg := &segs[i]
+		last := i == len(segs)-1
+
+		c, err := d.PeekCode()
+		if err != nil {
+			return nil, err
+		}
+
+		t := &patchTarget{
+			headerStart: int(d.InputOffset()),
+		}
+		switch {
+		case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+			t.isMap = true
+			t.len, err = d.DecodeMapLen()
+		case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+			t.len, err = d.DecodeArrayLen()
+		default:
+			return nil, ErrPathNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.headerEnd = int(d.InputOffset())
+
+		index := -1
+		if !t.isMap {
+			if !seg.isIndex {
+				return nil, ErrPathNotFound
+			}
+			index = resolveIndex(seg.index, t.len)
+			if index < 0 {
+				return nil, ErrPathNotFound
+			}
+		}
+
+		descend := false
+		for j := 0; j < t.len; j++ {
+			start := int(d.InputOffset())
+
+			match := j == index
+			if t.isMap {
+				key, err := d.queryKey()
+				if err != nil {
+					return nil, err
+				}
+				match = key == seg.key && !t.found
+			}
+
+			if match && !last {
+				descend = true
+				break
+			}
+			if match {
+				t.found = true
+				t.entryStart = start
+				t.valStart = int(d.InputOffset())
+			}
+
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			if match {
+				t.entryEnd = int(d.InputOffset())
+			}
+		}
+
+		if last {
+			t.end = int(d.InputOffset())
+			return t, nil
+		}
+		if !descend {
+			return nil, ErrPathNotFound
+		}
+	}
+	return nil, ErrPathNotFound
+}
+
+func splice(data []byte, start, end int, b []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(b))
+	out = append(out, data[:start]...)
+	out = append(out, b...)
+	out = append(out, data[end:]...)
+	return out
+}
+
+func appendMapEntry(data []byte, t *patchTarget, key string, value []byte) ([]byte, error) {
+	header, err := patchHeader(true, t.len+1)
+	if err != nil {
+		return nil, err
+	}
+	k, err := Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data)+len(header)+len(k)+len(value))
+	out = append(out, data[:t.headerStart]...)
+	out = append(out, header...)
+	out = append(out, data[t.headerEnd:t.end]...)
+	out = append(out, k...)
+	out = append(out, value...)
+	out = append(out, data[t.end:]...)
+	return out, nil
+}
+
+func patchHeader(isMap bool, n int) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	var err error
+	if isMap {
+		err = enc.EncodeMapLen(n)
+	} else {
+		err = enc.EncodeArrayLen(n)
+	}
+	return buf.Bytes(), err
+}
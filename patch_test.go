@@ -0,0 +1,117 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gostudentorg/msgpack/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type patchUser struct {
+	ID    int64  `msgpack:"id"`
+	Email string `msgpack:"email"`
+	Tags  []string
+}
+
+func TestPatch(t *testing.T) {
+	type doc struct {
+		User    patchUser `msgpack:"user"`
+		Version int64     `msgpack:"version"`
+	}
+
+	data, err := msgpack.Marshal(doc{
+		User:    patchUser{ID: 1, Email: "a@example.com", Tags: []string{"a", "b"}},
+		Version: 3,
+	})
+	require.Nil(t, err)
+
+	decode := func(b []byte) map[string]interface{} {
+		var m map[string]interface{}
+		require.Nil(t, msgpack.Unmarshal(b, &m))
+		return m
+	}
+
+	out, err := msgpack.Set(data, "user.email", "redacted")
+	require.Nil(t, err)
+	require.Equal(t, "redacted", decode(out)["user"].(map[string]interface{})["email"])
+	// The int64 id keeps its encoding.
+	id, err := msgpack.Marshal(int64(1))
+	require.Nil(t, err)
+	require.True(t, bytes.Contains(out, append([]byte("\xa2id"), id...)))
+
+	out, err = msgpack.Set(data, "version", int64(4))
+	require.Nil(t, err)
+	require.Equal(t, int64(4), decode(out)["version"])
+	require.Equal(t, data[:len(data)-9], out[:len(out)-9])
+
+	out, err = msgpack.Set(data, "user.name", "alice")
+	require.Nil(t, err)
+	require.Equal(t, "alice", decode(out)["user"].(map[string]interface{})["name"])
+
+	out, err = msgpack.Set(data, "user.Tags[-1]", "c")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"a", "c"}, decode(out)["user"].(map[string]interface{})["Tags"])
+
+	out, err = msgpack.Delete(data, "user.email")
+	require.Nil(t, err)
+	user := decode(out)["user"].(map[string]interface{})
+	require.Len(t, user, 2)
+	require.NotContains(t, user, "email")
+
+	out, err = msgpack.Delete(data, "user.Tags.0")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"b"}, decode(out)["user"].(map[string]interface{})["Tags"])
+
+	out, err = msgpack.Insert(data, "user.Tags[1]", "x")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"a", "x", "b"}, decode(out)["user"].(map[string]interface{})["Tags"])
+
+	out, err = msgpack.Insert(data, "user.Tags[2]", "x")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"a", "b", "x"}, decode(out)["user"].(map[string]interface{})["Tags"])
+
+	out, err = msgpack.Insert(data, "meta", map[string]int{"n": 1})
+	require.Nil(t, err)
+	require.Len(t, decode(out), 3)
+
+	_, err = msgpack.Insert(data, "version", 1)
+	require.NotNil(t, err)
+
+	for _, path := range []string{"missing.id", "user.Tags[5]", "version.x", "user.Tags.x"} {
+		_, err = msgpack.Set(data, path, 1)
+		require.Equal(t, msgpack.ErrPathNotFound, err, path)
+	}
+	_, err = msgpack.Delete(data, "user.missing")
+	require.Equal(t, msgpack.ErrPathNotFound, err)
+
+	out, err = msgpack.Insert(data, "user.Tags[-2]", "x")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"x", "a", "b"}, decode(out)["user"].(map[string]interface{})["Tags"])
+
+	// Negative indexes before the first element don't exist.
+	for _, path := range []string{"user.Tags[-3]", "user.Tags[-10]"} {
+		_, err = msgpack.Set(data, path, 1)
+		require.Equal(t, msgpack.ErrPathNotFound, err, path)
+		_, err = msgpack.Delete(data, path)
+		require.Equal(t, msgpack.ErrPathNotFound, err, path)
+		_, err = msgpack.Insert(data, path, 1)
+		require.Equal(t, msgpack.ErrPathNotFound, err, path)
+		_, err = msgpack.Set(data, path+".x", 1)
+		require.Equal(t, msgpack.ErrPathNotFound, err, path)
+	}
+
+	_, err = msgpack.Set(data, "user.*", 1)
+	require.NotNil(t, err)
+
+	// A map that outgrows the fixmap header gets a map16 header.
+	big := make(map[string]int, 15)
+	for i := 0; i < 15; i++ {
+		big[string(rune('a'+i))] = i
+	}
+	data, err = msgpack.Marshal(big)
+	require.Nil(t, err)
+	out, err = msgpack.Set(data, "z", 25)
+	require.Nil(t, err)
+	require.Len(t, decode(out), 16)
+}
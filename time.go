@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"time"
 
@@ -18,10 +19,87 @@ const millisec = 1000000
 var timeExtID int8 = 13
 var timeExtID2 int8 = -1
 
+// TimeFormat selects how the Encoder writes time.Time values.
+type TimeFormat int
+
+const (
+	// TimeFormatMillisFloat encodes time as ext 13 holding a float64 of
+	// milliseconds since the Unix epoch. It is the default.
+	TimeFormatMillisFloat TimeFormat = iota
+	// TimeFormatSpec encodes time as the MessagePack timestamp extension (ext -1)
+	// using the smallest of the 32, 64 and 96-bit layouts. It keeps nanoseconds.
+	TimeFormatSpec
+	// TimeFormatRFC3339 encodes time as a string in time.RFC3339Nano layout.
+	TimeFormatRFC3339
+	// TimeFormatUnixInt encodes time as an int64 of milliseconds since the Unix epoch.
+	TimeFormatUnixInt
+)
+
+// TimeOptions controls how the Decoder decodes time.Time values.
+type TimeOptions struct {
+	// Layouts are tried in order when a string does not match
+	// time.RFC3339Nano or the time.Time.String layout.
+	Layouts []string
+	// IntUnit is the unit of integer timestamps, e.g. time.Second.
+	// The default is time.Millisecond.
+	IntUnit time.Duration
+	// Location, if set, is applied to every decoded time. Layouts without
+	// a time zone are parsed in it.
+	Location *time.Location
+}
+
 func init() {
 	RegisterExtEncoder(timeExtID, time.Time{}, timeEncoder)
 	RegisterExtDecoder(timeExtID, time.Time{}, timeDecoder)
 	RegisterExtDecoder(timeExtID2, time.Time{}, timeDecoder)
+
+	// Replace the ext codecs so that time.Time honours the Encoder's TimeFormat,
+	// SetTimeEncoder and SetTimeDecoder. Registering another ext for time.Time
+	// replaces them again.
+	extEncoder, _ := typeEncMap.Load(timeType)
+	typeEncMap.Store(timeType, makeTimeEncoder(extEncoder.(encoderFunc)))
+	typeDecMap.Store(timeType, decoderFunc(decodeTimeValue))
+}
+
+func makeTimeEncoder(extEncoder encoderFunc) encoderFunc {
+	return func(e *Encoder, v reflect.Value) error {
+		// The default format takes the ext encoder's path, which doesn't
+		// box the value again.
+		if e.timeEncFn == nil && e.flags&canonicalFlag == 0 && e.timeFormat == TimeFormatMillisFloat {
+			return extEncoder(e, v)
+		}
+
+		tm := v.Interface().(time.Time)
+		if e.timeEncFn != nil {
+			return e.timeEncFn(e, tm)
+		}
+		return e.EncodeTime(tm)
+	}
+}
+
+func decodeTimeValue(d *Decoder, v reflect.Value) error {
+	if d.hasNilCode() {
+		v.Set(reflect.Zero(timeType))
+		return d.DecodeNil()
+	}
+	tm, err := d.decodeTimeDefault()
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(tm))
+	return nil
+}
+
+func (d *Decoder) decodeTimeDefault() (time.Time, error) {
+	if d.timeDecFn != nil {
+		return d.timeDecFn(d)
+	}
+	return d.DecodeTime()
+}
+
+// unixMillis returns tm as milliseconds since the Unix epoch.
+func unixMillis(tm time.Time) int64 {
+	return tm.Unix()*1000 + int64(tm.Nanosecond())/millisec
 }
 
 func timeEncoder(_ *Encoder, v reflect.Value) ([]byte, error) {
@@ -32,7 +110,7 @@ func timeEncoder(_ *Encoder, v reflect.Value) ([]byte, error) {
 
 	b := bytes.Buffer{}
 	e := NewEncoder(&b)
-	if r := e.EncodeFloat64(float64(t.Unix()*1000 + int64(t.Nanosecond())/millisec)); r != nil {
+	if r := e.EncodeFloat64(float64(unixMillis(t))); r != nil {
 		return nil, r
 	}
 
@@ -46,22 +124,70 @@ func timeDecoder(d *Decoder, v reflect.Value, extLen int) error {
 	}
 
 	ptr := v.Addr().Interface().(*time.Time)
-	*ptr = tm
+	*ptr = d.timeInLocation(tm)
 
 	return nil
 }
 
+// EncodeTime encodes tm in the format set by SetTimeFormat, or as the
+// MessagePack timestamp extension in canonical mode.
 func (e *Encoder) EncodeTime(tm time.Time) error {
+	if e.flags&canonicalFlag != 0 {
+		return e.encodeSpecTime(tm)
+	}
+	switch e.timeFormat {
+	case TimeFormatSpec:
+		return e.encodeSpecTime(tm)
+	case TimeFormatRFC3339:
+		return e.EncodeString(tm.Format(time.RFC3339Nano))
+	case TimeFormatUnixInt:
+		return e.EncodeInt64(unixMillis(tm))
+	}
+
 	if err := e.encodeExtLen(9); err != nil {
 		return err
 	}
 	if err := e.w.WriteByte(byte(timeExtID)); err != nil {
 		return err
 	}
-	return e.write8(msgpcode.Double, math.Float64bits(float64(tm.Unix()*1000+int64(tm.Nanosecond())/millisec)))
+	return e.write8(msgpcode.Double, math.Float64bits(float64(unixMillis(tm))))
+}
+
+// encodeSpecTime encodes tm as the MessagePack timestamp extension.
+func (e *Encoder) encodeSpecTime(tm time.Time) error {
+	e.timeBuf = appendSpecTime(e.timeBuf[:0], tm)
+	return e.write(e.timeBuf)
+}
+
+// appendSpecTime appends tm encoded as the MessagePack timestamp extension
+// using the smallest of the 32, 64 and 96-bit layouts.
+func appendSpecTime(b []byte, tm time.Time) []byte {
+	secs := uint64(tm.Unix())
+	if secs>>34 == 0 {
+		data := uint64(tm.Nanosecond())<<34 | secs
+		if data&0xffffffff00000000 == 0 {
+			return append4(appendExtLen(b, 4), byte(timeExtID2), uint32(data))
+		}
+		return append8(appendExtLen(b, 8), byte(timeExtID2), data)
+	}
+
+	b = append4(appendExtLen(b, 12), byte(timeExtID2), uint32(tm.Nanosecond()))
+	return append(b,
+		byte(secs>>56), byte(secs>>48), byte(secs>>40), byte(secs>>32),
+		byte(secs>>24), byte(secs>>16), byte(secs>>8), byte(secs))
 }
 
+// DecodeTime decodes time in any of the formats written by EncodeTime,
+// the legacy [sec, nsec] array and the MessagePack timestamp extension.
 func (d *Decoder) DecodeTime() (time.Time, error) {
+	tm, err := d.decodeTimeAny()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.timeInLocation(tm), nil
+}
+
+func (d *Decoder) decodeTimeAny() (time.Time, error) {
 	c, err := d.readCode()
 	if err != nil {
 		return time.Time{}, err
@@ -87,7 +213,15 @@ func (d *Decoder) DecodeTime() (time.Time, error) {
 		if err != nil {
 			return time.Time{}, err
 		}
-		return stringToTime(s)
+		return d.parseTime(s)
+	}
+	if msgpcode.IsFixedNum(c) || msgpcode.IsInt(c) || msgpcode.IsUInt(c) {
+		n, err := d.int(c)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return d.intToTime(n)
 	}
 	if msgpcode.IsFloat(c) {
 		f, err := d.float64(c)
@@ -98,6 +232,25 @@ func (d *Decoder) DecodeTime() (time.Time, error) {
 		return time.Unix(0, int64(f*millisec)), nil
 	}
 
+	if c == msgpcode.Nil {
+		return time.Time{}, nil
+	}
+	if !msgpcode.IsExt(c) {
+		if d.flags&strictTypesFlag != 0 {
+			return time.Time{}, &TypeMismatchError{Kind: reflect.Struct, Code: c}
+		}
+		val, err := d.decodeInterfaceFromCode(c)
+		if err != nil {
+			return time.Time{}, err
+		}
+		tm, err := d.interfaceToTime(val)
+		if err != nil {
+			logConversionError(err)
+			return tm, nil
+		}
+		return tm, nil
+	}
+
 	extID, extLen, err := d.extHeader(c)
 	if err != nil {
 		return time.Time{}, err
@@ -140,14 +293,14 @@ func (d *Decoder) decodeTime(extLen int) (time.Time, error) {
 		return time.Unix(int64(sec), int64(nsec)), nil
 	default:
 		t := time.Time{}
-		if r := unmarshalTime(b, &t); r != nil {
+		if r := d.unmarshalTime(b, &t); r != nil {
 			return time.Time{}, r
 		}
 		return t, nil
 	}
 }
 
-func unmarshalTime(data []byte, d *time.Time) error {
+func (d *Decoder) unmarshalTime(data []byte, tm *time.Time) error {
 	if len(data) == 0 {
 		return nil
 	}
@@ -162,18 +315,22 @@ func unmarshalTime(data []byte, d *time.Time) error {
 		if val == 0 {
 			return nil
 		}
-		*d = time.Unix(0, int64(val*millisec))
+		*tm = time.Unix(0, int64(val*millisec))
 	case int64:
-		*d = time.Unix(val/1000, (val%1000)*millisec)
+		t, err := d.intToTime(val)
+		if err != nil {
+			return err
+		}
+		*tm = t
 	case string:
-		t, err := stringToTime(val)
+		t, err := d.parseTime(val)
 		if err != nil {
 			return errors.Wrap(err, errors.Msg("unmarshalTime: string layout not implemented"),
 				errors.Fields{"value": val})
 		}
-		*d = t
+		*tm = t
 	case *time.Time:
-		*d = *val
+		*tm = *val
 	default:
 		return errors.New("unmarshalTime: unimplemented type", errors.Fields{
 			"type":      reflect.TypeOf(v).String(),
@@ -184,3 +341,69 @@ func unmarshalTime(data []byte, d *time.Time) error {
 
 	return nil
 }
+
+// parseTime is like stringToTime, but also tries the layouts from TimeOptions.
+func (d *Decoder) parseTime(s string) (time.Time, error) {
+	tm, err := stringToTime(s)
+	if err == nil || len(d.timeOptions.Layouts) == 0 {
+		return tm, err
+	}
+
+	loc := d.timeOptions.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range d.timeOptions.Layouts {
+		if t, r := time.ParseInLocation(layout, s, loc); r == nil {
+			return t, nil
+		}
+	}
+	return tm, err
+}
+
+// intToTime converts an integer timestamp in TimeOptions.IntUnit to time.
+func (d *Decoder) intToTime(n int64) (time.Time, error) {
+	unit := d.timeOptions.IntUnit
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+	if ns := time.Duration(n) * unit; ns/unit == time.Duration(n) {
+		return time.Unix(0, int64(ns)), nil
+	}
+
+	// The timestamp is more than 292 years away from the epoch.
+	ns := new(big.Int).Mul(big.NewInt(n), big.NewInt(int64(unit)))
+	sec, nsec := new(big.Int).DivMod(ns, big.NewInt(int64(time.Second)), new(big.Int))
+	if !sec.IsInt64() {
+		return time.Time{}, newConversionError(n, timeType, ConversionOverflow)
+	}
+	return time.Unix(sec.Int64(), nsec.Int64()), nil
+}
+
+func (d *Decoder) timeInLocation(tm time.Time) time.Time {
+	if d.timeOptions.Location == nil {
+		return tm
+	}
+	return tm.In(d.timeOptions.Location)
+}
+
+// interfaceToTime is like ToTimeE, but honours the decoder's TimeOptions.
+func (d *Decoder) interfaceToTime(i interface{}) (time.Time, error) {
+	var tm time.Time
+	var err error
+	switch v := i.(type) {
+	case string:
+		tm, err = d.parseTime(v)
+		if err != nil {
+			convErr := newConversionError(i, timeType, ConversionInvalidSyntax)
+			convErr.Err = err
+			err = convErr
+		}
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		n, _ := ToInt64E(v)
+		tm, err = d.intToTime(n)
+	default:
+		tm, err = ToTimeE(i)
+	}
+	return d.timeInLocation(tm), err
+}
@@ -3,8 +3,8 @@ package msgpack
 import (
 	"encoding"
 	"reflect"
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/vmihailenco/tagparser/v2"
 	"gitlab.gostudent.cloud/pkg/log"
@@ -111,24 +111,23 @@ func (f *field) EncodeValue(e *Encoder, strct reflect.Value) error {
 	if !ok {
 		return e.EncodeNil()
 	}
+	if e.extRegistry != nil {
+		if fn, ok := e.extRegistry.encoder(v.Type()); ok {
+			return fn(e, v)
+		}
+	}
 	return f.encoder(e, v)
 }
 
-var reflectTime = reflect.TypeOf(time.Time{})
-
 func (f *field) DecodeValue(d *Decoder, strct reflect.Value) error {
 	v := fieldByIndexAlloc(strct, f.index)
 	if !v.CanSet() {
 		return errors.Errorf("msgpack interface decoding: cannot set field %s", f.name)
 	}
-
-	if v.Type() == reflectTime {
-		iface, err := d.DecodeInterface()
-		if err != nil {
-			return err
+	if d.extRegistry != nil {
+		if fn, ok := d.extRegistry.decoder(v.Type()); ok {
+			return fn(d, v)
 		}
-		v.Set(reflect.ValueOf(ToTime(iface)))
-		return nil
 	}
 
 	return f.decoder(d, v)
@@ -140,6 +139,7 @@ type fields struct {
 	Type    reflect.Type
 	Map     map[string]*field
 	List    []*field
+	Sorted  []*field // List in the order of encoded field names
 	AsArray bool
 
 	hasOmitEmpty bool
@@ -169,13 +169,17 @@ func (fs *fields) warnIfFieldExists(name string) {
 }
 
 func (fs *fields) OmitEmpty(strct reflect.Value, forced bool) []*field {
+	return fs.omitEmpty(fs.List, strct, forced)
+}
+
+func (fs *fields) omitEmpty(list []*field, strct reflect.Value, forced bool) []*field {
 	if !fs.hasOmitEmpty && !forced {
-		return fs.List
+		return list
 	}
 
-	fields := make([]*field, 0, len(fs.List))
+	fields := make([]*field, 0, len(list))
 
-	for _, f := range fs.List {
+	for _, f := range list {
 		if !f.Omit(strct, forced) {
 			fields = append(fields, f)
 		}
@@ -263,6 +267,19 @@ func getFields(typ reflect.Type, fallbackTag string) *fields {
 			fs.Map[alias] = field
 		}
 	}
+
+	// Encoded strings are ordered by length first, because the length is
+	// part of the header.
+	fs.Sorted = make([]*field, len(fs.List))
+	copy(fs.Sorted, fs.List)
+	sort.SliceStable(fs.Sorted, func(i, j int) bool {
+		a, b := fs.Sorted[i].name, fs.Sorted[j].name
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
 	return fs
 }
 
@@ -333,6 +350,15 @@ type isZeroer interface {
 	IsZero() bool
 }
 
+// IsEmpty reports whether v is empty according to the omitempty struct tag.
+func IsEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	return isEmptyValue(rv)
+}
+
 func isEmptyValue(v reflect.Value) bool {
 	kind := v.Kind()
 